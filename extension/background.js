@@ -1,48 +1,165 @@
 const api = typeof browser !== "undefined" ? browser : chrome;
-const API_URL = "http://127.0.0.1:8384/tab";
+const EVENTS_URL = "http://127.0.0.1:8384/v2/events";
+const PAIR_URL = "http://127.0.0.1:8384/pair";
+const PROTOCOL_VERSION = 2;
+const MAX_QUEUE = 500;
 
-let lastKey = null;
+let queue = [];
 let timer = null;
+let flushing = false;
+let pending = false; // flush was called while one was running
+let browserName = null;
+let windowFocused = true;
 
-function scheduleSend() {
-  clearTimeout(timer);
-  timer = setTimeout(sendActiveTab, 150);
-}
-
-async function sendActiveTab() {
+// Chromium-based browsers share the extension origin, so tell the tracker which one this is
+async function detectBrowser() {
+  if (browserName !== null) return browserName;
+  browserName = "";
   try {
-    const tabs = await api.tabs.query({ active: true, currentWindow: true });
-    const tab = tabs[0];
-    if (!tab || !tab.url) return;
+    if (typeof browser !== "undefined") {
+      browserName = "Firefox";
+    } else if (navigator.brave && (await navigator.brave.isBrave())) {
+      browserName = "Brave";
+    } else if (navigator.userAgentData) {
+      const brands = navigator.userAgentData.brands.map((b) => b.brand);
+      if (brands.includes("Microsoft Edge")) browserName = "Edge";
+      else if (brands.includes("Vivaldi")) browserName = "Vivaldi";
+      else if (brands.includes("Google Chrome")) browserName = "Chrome";
+    }
+  } catch (e) {
+    console.debug("browser detection error:", e);
+  }
+  return browserName;
+}
 
-    const payload = {
+// enqueue stamps an event with the browser's clock and schedules a batched upload
+function enqueue(type, tab, extra = {}) {
+  const event = { type, ts: Date.now(), ...extra };
+  if (tab) {
+    Object.assign(event, {
       tabId: tab.id,
+      windowId: tab.windowId,
       title: tab.title || "",
-      url: tab.url,
-      ts: Date.now()
-    };
+      url: tab.url || "",
+      incognito: !!tab.incognito
+    });
+  }
+  queue.push(event);
+  if (queue.length > MAX_QUEUE) queue = queue.slice(-MAX_QUEUE);
+  scheduleFlush();
+}
 
-    const key = payload.tabId + payload.url;
-    if (key === lastKey) return;
-    lastKey = key;
+function scheduleFlush(delay = 250) {
+  clearTimeout(timer);
+  timer = setTimeout(flush, delay);
+}
+
+// flush uploads queued events; on failure they stay queued and are retried after 5 seconds.
+// Events queued while a flush is running are sent as soon as it finishes.
+async function flush() {
+  if (flushing) {
+    pending = true;
+    return;
+  }
+  if (queue.length === 0) return;
+  flushing = true;
+  pending = false;
+  let failed = false;
+  const batch = queue;
+  queue = [];
+  try {
+    const { token } = await api.storage.local.get("token");
+    if (!token) {
+      queue = batch.concat(queue).slice(-MAX_QUEUE); // keep until paired
+      return;
+    }
 
-    await fetch(API_URL, {
+    const res = await fetch(EVENTS_URL, {
       method: "POST",
-      headers: { "Content-Type": "application/json" },
-      body: JSON.stringify(payload)
+      headers: { "Content-Type": "application/json", Authorization: "Bearer " + token },
+      body: JSON.stringify({ version: PROTOCOL_VERSION, events: batch })
     });
-
-    console.log("Sent to tracker:", payload);
+    if (!res.ok) {
+      if (res.status === 401) console.debug("tracker rejected token; pair again from the popup");
+      queue = batch.concat(queue).slice(-MAX_QUEUE);
+      failed = true;
+    }
   } catch (e) {
     console.debug("send error:", e);
+    queue = batch.concat(queue).slice(-MAX_QUEUE);
+    failed = true;
+  } finally {
+    flushing = false;
+    if (failed) scheduleFlush(5000);
+    else if (pending) scheduleFlush();
+  }
+}
+
+async function reportActiveTab(windowId) {
+  try {
+    const query = windowId === undefined ? { active: true, currentWindow: true } : { active: true, windowId };
+    const tabs = await api.tabs.query(query);
+    if (tabs[0]) enqueue("tab_activated", tabs[0]);
+  } catch (e) {
+    console.debug("query error:", e);
+  }
+}
+
+// pair exchanges the one-time code shown in the tracker's systray for a bearer token
+async function pair(code) {
+  const res = await fetch(PAIR_URL, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ code, browser: await detectBrowser() })
+  });
+  if (!res.ok) throw new Error((await res.text()).trim() || res.statusText);
+
+  const { token } = await res.json();
+  await api.storage.local.set({ token });
+  reportActiveTab();
+}
+
+api.runtime.onMessage.addListener((message, _, sendResponse) => {
+  if (message.type !== "pair") return false;
+  pair(message.code).then(
+    () => sendResponse({ ok: true }),
+    (e) => sendResponse({ ok: false, error: e.message })
+  );
+  return true; // respond asynchronously
+});
+
+api.tabs.onActivated.addListener(({ tabId }) => {
+  api.tabs.get(tabId).then((tab) => enqueue("tab_activated", tab), () => {});
+});
+api.tabs.onUpdated.addListener((_, changeInfo, tab) => {
+  if (changeInfo.url || changeInfo.title) enqueue("url_changed", tab);
+  if (changeInfo.audible === true) enqueue("audible_started", tab);
+  if (changeInfo.audible === false) enqueue("audible_stopped", tab);
+});
+api.windows.onFocusChanged.addListener((windowId) => {
+  windowFocused = windowId !== api.windows.WINDOW_ID_NONE;
+  if (!windowFocused) enqueue("window_focus_lost", null);
+  else reportActiveTab(windowId);
+});
+
+// Confirm the active tab every 30 seconds so the tracker can tell a quiet extension from a long visit
+async function heartbeat() {
+  try {
+    if (!windowFocused) {
+      enqueue("heartbeat", null, { tabId: 0 });
+      return;
+    }
+    const tabs = await api.tabs.query({ active: true, lastFocusedWindow: true });
+    enqueue("heartbeat", tabs[0] || null, tabs[0] ? {} : { tabId: 0 });
+  } catch (e) {
+    console.debug("heartbeat error:", e);
   }
 }
 
-api.tabs.onActivated.addListener(scheduleSend);
-api.tabs.onUpdated.addListener((_, changeInfo) => {
-  if (changeInfo.url) scheduleSend();
+api.alarms.create("heartbeat", { periodInMinutes: 0.5 });
+api.alarms.onAlarm.addListener((alarm) => {
+  if (alarm.name === "heartbeat") heartbeat();
 });
-api.windows.onFocusChanged.addListener(scheduleSend);
 
 // Send initial tab on load
-scheduleSend();
+reportActiveTab();
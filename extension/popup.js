@@ -0,0 +1,16 @@
+const api = typeof browser !== "undefined" ? browser : chrome;
+const status = document.getElementById("status");
+
+async function showState() {
+  const { token } = await api.storage.local.get("token");
+  status.textContent = token ? "Paired with tracker." : "Not paired.";
+}
+
+document.getElementById("pair").addEventListener("click", async () => {
+  const code = document.getElementById("code").value.trim();
+  status.textContent = "Pairing...";
+  const res = await api.runtime.sendMessage({ type: "pair", code });
+  status.textContent = res && res.ok ? "Paired with tracker." : "Pairing failed: " + (res ? res.error : "no response");
+});
+
+showState();
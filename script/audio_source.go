@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// audioCacheTTL limits how often the OS is asked which processes are playing sound
+const audioCacheTTL = 5 * time.Second
+
+// audioSource reports which executables are playing sound, chosen in onReady (nil when unavailable)
+var audioSource AudioSource
+
+// AudioSource reports the executables that currently have an active audio stream
+type AudioSource interface {
+	PlayingExecutables() (map[string]bool, error) // keyed by lowercase exe base name
+}
+
+// cachedAudioSource wraps an AudioSource so it is queried at most once per audioCacheTTL
+type cachedAudioSource struct {
+	mu      sync.Mutex
+	source  AudioSource
+	playing map[string]bool
+	fetched time.Time
+}
+
+// PlayingExecutables returns the cached result, refreshing it once it is older than audioCacheTTL
+func (c *cachedAudioSource) PlayingExecutables() (map[string]bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.fetched) < audioCacheTTL {
+		return c.playing, nil
+	}
+	playing, err := c.source.PlayingExecutables()
+	if err != nil {
+		return nil, err
+	}
+	c.playing = playing
+	c.fetched = time.Now()
+	return playing, nil
+}
+
+// isExePlayingAudio reports whether the OS says exeName is playing sound
+func isExePlayingAudio(exeName string) bool {
+	if audioSource == nil {
+		return false
+	}
+	playing, err := audioSource.PlayingExecutables()
+	if err != nil {
+		return false
+	}
+	return playing[strings.ToLower(exeName)]
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// pactlSource lists uncorked PulseAudio/PipeWire sink inputs through pactl
+type pactlSource struct {
+	path string
+}
+
+// pactlSinkInput is the subset of `pactl -f json list sink-inputs` used to find playing processes
+type pactlSinkInput struct {
+	Corked     bool              `json:"corked"`
+	Properties map[string]string `json:"properties"`
+}
+
+// newAudioSource returns the pactl source if pactl is installed
+func newAudioSource() (AudioSource, error) {
+	path, err := exec.LookPath("pactl")
+	if err != nil {
+		return nil, err
+	}
+	return &cachedAudioSource{source: pactlSource{path: path}}, nil
+}
+
+// PlayingExecutables returns the exe base names of processes with an uncorked sink input
+func (s pactlSource) PlayingExecutables() (map[string]bool, error) {
+	output, err := exec.Command(s.path, "-f", "json", "list", "sink-inputs").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []pactlSinkInput
+	if err := json.Unmarshal(output, &inputs); err != nil {
+		return nil, fmt.Errorf("decode pactl output: %w", err)
+	}
+
+	playing := map[string]bool{}
+	for _, input := range inputs {
+		if input.Corked {
+			continue
+		}
+		// Resolve the pid like the window sources do, so names match WindowReading.ExePath
+		name := input.Properties["application.process.binary"]
+		if pid := input.Properties["application.process.id"]; pid != "" {
+			if exePath, err := os.Readlink("/proc/" + pid + "/exe"); err == nil {
+				name = exeBaseName(exePath)
+			}
+		}
+		if name != "" {
+			playing[strings.ToLower(name)] = true
+		}
+	}
+	return playing, nil
+}
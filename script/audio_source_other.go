@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newAudioSource reports that OS audio sessions aren't queried on this platform yet;
+// audible browser tabs are still reported by the extension
+func newAudioSource() (AudioSource, error) {
+	return nil, fmt.Errorf("no audio source available on %s", runtime.GOOS)
+}
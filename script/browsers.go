@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// unknownTabName is recorded for browser time while the extension isn't reporting
+const unknownTabName = "Unknown tab"
+
+var (
+	// browserStates holds the collector's view of each browser, keyed by BrowserConfig.Name
+	browserStates   = map[string]*browserState{}
+	browserStatesMu sync.Mutex
+)
+
+// browserState is what the extension has told us about one browser
+type browserState struct {
+	Tab      TabInfo        // active tab of the focused browser window; zero while no window has focus
+	Audible  map[int64]bool // tabs currently playing sound
+	LastTS   int64          // client timestamp (ms) of the newest applied event
+	LastSeen time.Time      // when the extension last contacted the collector
+}
+
+// stale reports whether the tab state is too old to trust. The extension confirms its active tab at
+// least every extensionHeartbeatInterval, so a Tab.TS older than staleTabWindow means it has gone quiet.
+func (s *browserState) stale(now time.Time) bool {
+	last := s.LastSeen
+	if s.Tab.TS > 0 {
+		last = time.UnixMilli(s.Tab.TS)
+	}
+	return now.Sub(last) > staleTabWindow
+}
+
+// stateLocked returns the state for a browser, creating it if needed. browserStatesMu must be held.
+func stateLocked(browser string) *browserState {
+	state, ok := browserStates[browser]
+	if !ok {
+		state = &browserState{Audible: map[int64]bool{}}
+		browserStates[browser] = state
+	}
+	return state
+}
+
+// BrowserConfig maps a browser's executables to the name its paired extension reports tabs under
+type BrowserConfig struct {
+	Name        string   `json:"name"`        // key for tab state, e.g. "Chrome"
+	Executables []string `json:"executables"` // exe names on every OS, matched case-insensitively
+}
+
+// defaultBrowsers returns the registry used when collector.json has none
+func defaultBrowsers() []BrowserConfig {
+	return []BrowserConfig{
+		{Name: "Chrome", Executables: []string{"chrome.exe", "chrome", "google-chrome", "Google Chrome"}},
+		{Name: "Edge", Executables: []string{"msedge.exe", "msedge", "microsoft-edge", "Microsoft Edge"}},
+		{Name: "Brave", Executables: []string{"brave.exe", "brave", "brave-browser", "Brave Browser"}},
+		{Name: "Vivaldi", Executables: []string{"vivaldi.exe", "vivaldi-bin", "vivaldi", "Vivaldi"}},
+		{Name: "Firefox", Executables: []string{"firefox.exe", "firefox", "firefox-bin", "Firefox"}},
+	}
+}
+
+// browserForExe returns the registry entry whose executables include exeName
+func browserForExe(exeName string) (BrowserConfig, bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	for _, browser := range config.Browsers {
+		for _, exe := range browser.Executables {
+			if strings.EqualFold(exe, exeName) {
+				return browser, true
+			}
+		}
+	}
+	return BrowserConfig{}, false
+}
+
+// setTab records the active tab reported for a browser
+func setTab(browser string, tab TabInfo) {
+	browserStatesMu.Lock()
+	defer browserStatesMu.Unlock()
+
+	state := stateLocked(browser)
+	state.Tab = tab
+	state.LastSeen = time.Now()
+	if tab.TS > state.LastTS {
+		state.LastTS = tab.TS
+	}
+}
+
+// getTab returns the last tab reported for a browser, or an explicit unknown tab if the
+// extension has gone quiet (or never reported)
+func getTab(browser string) TabInfo {
+	browserStatesMu.Lock()
+	defer browserStatesMu.Unlock()
+
+	state := stateLocked(browser)
+	if state.stale(time.Now()) {
+		return TabInfo{Title: unknownTabName}
+	}
+	return state.Tab
+}
+
+// isTabAudible reports whether the extension says a browser tab is playing sound
+func isTabAudible(browser string, tabID int64) bool {
+	browserStatesMu.Lock()
+	defer browserStatesMu.Unlock()
+	return stateLocked(browser).Audible[tabID]
+}
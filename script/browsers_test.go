@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBrowserStateStale(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	tests := []struct {
+		name  string
+		state browserState
+		want  bool
+	}{
+		{"never heard from", browserState{}, true},
+		{"recent contact without a tab", browserState{LastSeen: ago(time.Minute)}, false},
+		{"old contact without a tab", browserState{LastSeen: ago(2 * staleTabWindow)}, true},
+		{"recently confirmed tab", browserState{Tab: TabInfo{TabID: 1, TS: ago(time.Minute).UnixMilli()}, LastSeen: ago(time.Minute)}, false},
+		// Requests that carry only old events don't count as the extension reporting
+		{"old tab despite recent contact", browserState{Tab: TabInfo{TabID: 1, TS: ago(2 * staleTabWindow).UnixMilli()}, LastSeen: ago(time.Second)}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.state.stale(now); got != test.want {
+				t.Errorf("stale = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetTabWhenExtensionGoesQuiet(t *testing.T) {
+	resetBrowser(t, "Test")
+	now := time.Now()
+
+	// The last event is older than the stale window: the tab is unknown rather than the old one
+	applyEvents("Test", []ExtensionEvent{{Type: ExtEventTabActivated, TS: now.Add(-2 * staleTabWindow).UnixMilli(), TabID: 1, Title: "old"}})
+	if tab := getTab("Test"); tab.Title != unknownTabName || tab.TabID != 0 {
+		t.Errorf("got %+v, want the unknown tab", tab)
+	}
+
+	// A heartbeat brings it back
+	applyEvents("Test", []ExtensionEvent{{Type: ExtEventHeartbeat, TS: now.UnixMilli(), TabID: 1, Title: "old"}})
+	if tab := getTab("Test"); tab.Title != "old" || tab.TabID != 1 {
+		t.Errorf("got %+v after a heartbeat, want tab 1", tab)
+	}
+}
+
+func TestExtensionStatus(t *testing.T) {
+	resetBrowser(t, "Test")
+	configMu.Lock()
+	saved := config.Extensions
+	config.Extensions = []TrustedExtension{{Browser: "Test"}, {Browser: "Test"}}
+	configMu.Unlock()
+	t.Cleanup(func() {
+		configMu.Lock()
+		config.Extensions = saved
+		configMu.Unlock()
+	})
+
+	now := time.Now()
+	if got, want := extensionStatus(now), "Browser extension: Test not connected"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	applyEvents("Test", []ExtensionEvent{{Type: ExtEventHeartbeat, TS: now.UnixMilli(), TabID: 1}})
+	if got, want := extensionStatus(now), "Browser extension: Test connected"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Quiet for longer than the stale window, then reporting again
+	later := now.Add(2 * staleTabWindow)
+	browserStatesMu.Lock()
+	lastSeen := stateLocked("Test").LastSeen
+	browserStatesMu.Unlock()
+	if got, want := extensionStatus(later), "Browser extension: Test quiet since "+lastSeen.Format("15:04"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	applyEvents("Test", []ExtensionEvent{{Type: ExtEventHeartbeat, TS: later.UnixMilli(), TabID: 1}})
+	if got, want := extensionStatus(later), "Browser extension: Test connected"; got != want {
+		t.Errorf("got %q after events resumed, want %q", got, want)
+	}
+}
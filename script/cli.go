@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"trackerdata"
+)
+
+// runCommand handles command-line subcommands and returns the process exit code.
+// Without a subcommand the collector runs in the systray as usual.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "redact-test":
+		return runRedactTest(args[1:])
+	case "import-sqlite":
+		return runImportSQLite(args[1:])
+	case "compact":
+		return runCompact(args[1:])
+	case "retention":
+		return runRetention(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		fmt.Fprintln(os.Stderr, "commands: redact-test, import-sqlite, compact, retention")
+		return 2
+	}
+}
+
+// commandConfig reads collector.json for a subcommand. Unlike loadConfig it never writes the file,
+// so running a command leaves the data folder as it was.
+func commandConfig() collectorConfig {
+	cfg, _ := readConfig()
+	return cfg
+}
+
+// runRedactTest applies the configured redaction rules to sample strings and prints the results.
+// Samples come from the arguments, or from stdin (one per line) if there are none.
+func runRedactTest(args []string) int {
+	flags := flag.NewFlagSet("redact-test", flag.ContinueOnError)
+	asURL := flags.Bool("url", false, "treat samples as URLs instead of tab titles")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	r, errs := NewRedactor(commandConfig().Redaction)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	samples := flags.Args()
+	if len(samples) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			samples = append(samples, scanner.Text())
+		}
+	}
+
+	for _, sample := range samples {
+		var redacted string
+		var fired []string
+		if *asURL {
+			redacted, fired = r.RedactURL(sample)
+		} else {
+			redacted, fired = r.RedactTitle(sample)
+		}
+
+		rules := "no rules matched"
+		if len(fired) > 0 {
+			rules = "rules: " + strings.Join(fired, ", ")
+		}
+		fmt.Printf("%s\n  -> %s  (%s)\n", sample, redacted, rules)
+	}
+
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runImportSQLite imports the day files of completed days into tracker.db and archives them read-only.
+// Today's files are left alone, since the collector may still be writing them.
+func runImportSQLite(args []string) int {
+	flags := flag.NewFlagSet("import-sqlite", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list what would be imported without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	data_dir := trackerdata.Dir()
+	db, err := trackerdata.OpenDB(filepath.Join(data_dir, trackerdata.DBName))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	_, loc := recordingZone()
+	results, err := trackerdata.ImportDayFiles(db, data_dir, time.Now().In(loc).Format("20060102"), *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	failed := 0
+	rows := 0
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("%s: %v\n", result.File, result.Err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: %d rows\n", result.File, result.Rows)
+		rows += result.Rows
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d rows from %d files into %s", verb, rows, len(results)-failed, filepath.Join(data_dir, trackerdata.DBName))
+	if failed > 0 {
+		fmt.Printf(", %d files failed", failed)
+	}
+	fmt.Println()
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runCompact replaces the day files of days older than -after-days with compacted files and archives the originals
+func runCompact(args []string) int {
+	afterDays := commandConfig().Compaction.AfterDays
+	if afterDays <= 0 {
+		afterDays = 30
+	}
+	flags := flag.NewFlagSet("compact", flag.ContinueOnError)
+	flags.IntVar(&afterDays, "after-days", afterDays, "compact days at least this many days old")
+	dryRun := flags.Bool("dry-run", false, "list what would be compacted without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if afterDays < 1 {
+		fmt.Fprintln(os.Stderr, "-after-days must be at least 1, since the collector writes today's file")
+		return 2
+	}
+
+	results, err := trackerdata.CompactDayFiles(trackerdata.Dir(), compactionCutoff(afterDays), *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("%s: %v\n", result.Day, result.Err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: %s -> %d spans\n", result.Day, strings.Join(result.Files, ", "), result.Spans)
+	}
+
+	verb := "Compacted"
+	if *dryRun {
+		verb = "Would compact"
+	}
+	fmt.Printf("%s %d days", verb, len(results)-failed)
+	if failed > 0 {
+		fmt.Printf(", %d days failed", failed)
+	}
+	fmt.Println()
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runRetention applies the retention policy from collector.json now, or with -dry-run reports what it would change
+func runRetention(args []string) int {
+	flags := flag.NewFlagSet("retention", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would change without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	policy := commandConfig().Retention
+	if policy == (RetentionConfig{}) {
+		fmt.Println("No retention limits are set in collector.json; everything is kept")
+		return 0
+	}
+
+	store, err := trackerdata.OpenConfiguredStore(trackerdata.Dir())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer store.Close()
+
+	results, err := trackerdata.ApplyRetention(store, policy, today(), *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("%s: %v\n", result.Day, result.Err)
+			failed++
+			continue
+		}
+		fmt.Println(describeRetention(result))
+	}
+
+	verb := "Changed"
+	if *dryRun {
+		verb = "Would change"
+	}
+	fmt.Printf("%s %d days", verb, len(results)-failed)
+	if failed > 0 {
+		fmt.Printf(", %d days failed", failed)
+	}
+	fmt.Println()
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// describeRetention summarises the changes to one day
+func describeRetention(result trackerdata.RetentionResult) string {
+	changes := []string{}
+	if result.TitlesStripped > 0 {
+		changes = append(changes, fmt.Sprintf("%d titles removed", result.TitlesStripped))
+	}
+	if result.URLsReduced > 0 {
+		changes = append(changes, fmt.Sprintf("%d URLs reduced to domains", result.URLsReduced))
+	}
+	if result.Aggregated {
+		changes = append(changes, fmt.Sprintf("%d rows reduced to %d daily totals", result.Rows, result.Kept))
+	} else if result.Rows != result.Kept {
+		changes = append(changes, fmt.Sprintf("%d rows rewritten as %d spans", result.Rows, result.Kept))
+	}
+	if result.Archived {
+		changes = append(changes, "archived copies deleted")
+	}
+	return result.Day + ": " + strings.Join(changes, ", ")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"trackerdata"
+)
+
+var (
+	// config holds the collector settings, loaded in onReady
+	config   collectorConfig
+	configMu sync.Mutex
+)
+
+// collectorConfig is read from collector.json in the data folder. Missing keys fall back to defaults,
+// and unknown keys are preserved when the file is written back.
+type collectorConfig struct {
+	Browsers        []BrowserConfig    `json:"browsers"`
+	Extensions      []TrustedExtension `json:"trusted_extensions"`
+	IncognitoPolicy IncognitoPolicy    `json:"incognito_policy"`
+	Redaction       RedactionConfig    `json:"redaction"`
+	CountInput      bool               `json:"count_input"` // record keystroke, click and scroll counts (opt-in)
+	Storage         StorageConfig      `json:"storage"`
+	Compaction      CompactionConfig   `json:"compaction"`
+	Retention       RetentionConfig    `json:"retention"`
+	WindowProvider  DBusWindowProvider `json:"dbus_window_provider"` // used by the dbus window source on Wayland
+}
+
+// defaultConfig returns the settings used when collector.json is missing or incomplete
+func defaultConfig() collectorConfig {
+	return collectorConfig{
+		Browsers:        defaultBrowsers(),
+		Extensions:      []TrustedExtension{},
+		IncognitoPolicy: IncognitoGeneric,
+		Redaction:       defaultRedaction(),
+		Storage:         defaultStorage(),
+		WindowProvider:  defaultDBusWindowProvider(),
+	}
+}
+
+// configPath returns the location of collector.json
+func configPath() string {
+	return trackerdata.Path("collector.json")
+}
+
+// loadConfig reads collector.json, writing the defaults for any missing keys back to the file
+func loadConfig() collectorConfig {
+	cfg, rawConfig := readConfig()
+
+	// Write back if any setting is missing, so every setting is visible in the file
+	known := map[string]json.RawMessage{}
+	if data, err := json.Marshal(cfg); err == nil {
+		json.Unmarshal(data, &known)
+	}
+	for key := range known {
+		if _, exists := rawConfig[key]; !exists {
+			saveConfig(cfg)
+			break
+		}
+	}
+	return cfg
+}
+
+// readConfig reads collector.json without changing it, returning the settings and the keys present in the file.
+// Keys present in the file override the defaults.
+func readConfig() (collectorConfig, map[string]json.RawMessage) {
+	cfg := defaultConfig()
+	rawConfig := map[string]json.RawMessage{}
+	if data, err := os.ReadFile(configPath()); err == nil {
+		json.Unmarshal(data, &rawConfig)
+		json.Unmarshal(data, &cfg)
+	}
+	return cfg, rawConfig
+}
+
+// saveConfig persists the config to collector.json, preserving keys it doesn't know about
+func saveConfig(cfg collectorConfig) error {
+	path := configPath()
+
+	rawConfig := map[string]json.RawMessage{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &rawConfig)
+	}
+
+	// Round-trip the struct through JSON to merge its keys over the existing ones
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &rawConfig); err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(rawConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, output, 0644)
+}
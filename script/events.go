@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Event types accepted by /v2/events
+const (
+	ExtEventTabActivated    = "tab_activated"     // a tab became active in the focused window
+	ExtEventURLChanged      = "url_changed"       // a tab navigated or changed its title
+	ExtEventWindowFocusLost = "window_focus_lost" // no window of this browser has focus any more
+	ExtEventAudibleStarted  = "audible_started"   // a tab started playing sound
+	ExtEventAudibleStopped  = "audible_stopped"   // a tab stopped playing sound
+	ExtEventHeartbeat       = "heartbeat"         // periodic confirmation of the active tab (tabId 0 if unfocused)
+)
+
+// extensionProtocolVersion is the batch version understood by eventsHandler
+const extensionProtocolVersion = 2
+
+// ExtensionEvent is one typed event from the browser extension, stamped with the browser's clock
+type ExtensionEvent struct {
+	Type      string `json:"type"`
+	TS        int64  `json:"ts"` // client time, ms since epoch
+	TabID     int64  `json:"tabId"`
+	WindowID  int64  `json:"windowId"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Incognito bool   `json:"incognito"`
+}
+
+// eventBatch is the body of POST /v2/events
+type eventBatch struct {
+	Version int              `json:"version"`
+	Events  []ExtensionEvent `json:"events"`
+}
+
+// applyEvents applies a batch to a browser's state in timestamp order. Events older than the newest
+// event already applied (e.g. from a batch that was retried late) are skipped. Returns how many were applied.
+func applyEvents(browser string, events []ExtensionEvent) int {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].TS < events[j].TS
+	})
+
+	browserStatesMu.Lock()
+	defer browserStatesMu.Unlock()
+
+	state := stateLocked(browser)
+	state.LastSeen = time.Now()
+	applied := 0
+	for _, ev := range events {
+		if ev.TS < state.LastTS {
+			continue
+		}
+		if !state.apply(ev) {
+			continue
+		}
+		state.LastTS = ev.TS
+		applied++
+	}
+	return applied
+}
+
+// apply updates the state with a single event, returning false for unknown event types
+func (s *browserState) apply(ev ExtensionEvent) bool {
+	switch ev.Type {
+	case ExtEventTabActivated:
+		s.Tab = TabInfo{
+			TabID:     ev.TabID,
+			WindowID:  ev.WindowID,
+			Title:     ev.Title,
+			URL:       ev.URL,
+			Incognito: ev.Incognito,
+			TS:        ev.TS,
+		}
+	case ExtEventURLChanged:
+		// Background tabs navigate too; only the active one matters for readings
+		if ev.TabID == s.Tab.TabID {
+			s.Tab.Title = ev.Title
+			s.Tab.URL = ev.URL
+			s.Tab.Incognito = ev.Incognito
+			s.Tab.TS = ev.TS
+		}
+	case ExtEventWindowFocusLost:
+		s.Tab = TabInfo{TS: ev.TS}
+	case ExtEventHeartbeat:
+		// Refresh the active tab, resynchronizing if an earlier event was lost
+		if ev.TabID == s.Tab.TabID {
+			s.Tab.TS = ev.TS
+		} else if ev.TabID == 0 {
+			s.Tab = TabInfo{TS: ev.TS}
+		} else {
+			s.Tab = TabInfo{
+				TabID:     ev.TabID,
+				WindowID:  ev.WindowID,
+				Title:     ev.Title,
+				URL:       ev.URL,
+				Incognito: ev.Incognito,
+				TS:        ev.TS,
+			}
+		}
+	case ExtEventAudibleStarted:
+		s.Audible[ev.TabID] = true
+	case ExtEventAudibleStopped:
+		delete(s.Audible, ev.TabID)
+	default:
+		return false
+	}
+	return true
+}
+
+// eventsHandler accepts a batch of typed extension events (protocol v2)
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	ext, ok := authorizeExtensionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var batch eventBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if batch.Version != extensionProtocolVersion {
+		http.Error(w, "Unsupported protocol version", http.StatusBadRequest)
+		return
+	}
+
+	applied := applyEvents(ext.Browser, batch.Events)
+	if applied > 0 {
+		notifyStateChanged()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "applied": applied})
+}
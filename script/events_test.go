@@ -0,0 +1,119 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// resetBrowser clears the state of a browser before and after a test
+func resetBrowser(t *testing.T, browser string) {
+	t.Helper()
+	reset := func() {
+		browserStatesMu.Lock()
+		delete(browserStates, browser)
+		browserStatesMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestApplyEvents(t *testing.T) {
+	activated := func(ts, tab int64, title string) ExtensionEvent {
+		return ExtensionEvent{Type: ExtEventTabActivated, TS: ts, TabID: tab, Title: title}
+	}
+	changed := func(ts, tab int64, title string) ExtensionEvent {
+		return ExtensionEvent{Type: ExtEventURLChanged, TS: ts, TabID: tab, Title: title}
+	}
+
+	tests := []struct {
+		name        string
+		batches     [][]ExtensionEvent
+		wantApplied []int // per batch
+		wantTab     int64
+		wantTitle   string
+	}{
+		{
+			name:        "a batch is applied in timestamp order",
+			batches:     [][]ExtensionEvent{{changed(300, 1, "last"), activated(100, 1, "first"), changed(200, 1, "middle")}},
+			wantApplied: []int{3},
+			wantTab:     1, wantTitle: "last",
+		},
+		{
+			name: "a late retry older than what was applied is dropped",
+			batches: [][]ExtensionEvent{
+				{activated(500, 2, "current")},
+				{activated(300, 1, "old"), changed(400, 1, "older page")},
+			},
+			wantApplied: []int{1, 0},
+			wantTab:     2, wantTitle: "current",
+		},
+		{
+			name: "only the stale part of a batch is dropped",
+			batches: [][]ExtensionEvent{
+				{activated(500, 2, "current")},
+				{changed(400, 2, "stale"), changed(500, 2, "same time"), changed(600, 2, "newer")},
+			},
+			wantApplied: []int{1, 2},
+			wantTab:     2, wantTitle: "newer",
+		},
+		{
+			name:        "background tabs don't change the active one",
+			batches:     [][]ExtensionEvent{{activated(100, 1, "active"), changed(200, 7, "background")}},
+			wantApplied: []int{2},
+			wantTab:     1, wantTitle: "active",
+		},
+		{
+			name: "a heartbeat for another tab resynchronizes after a lost event",
+			batches: [][]ExtensionEvent{
+				{activated(100, 1, "a")},
+				{{Type: ExtEventHeartbeat, TS: 300, TabID: 3, Title: "c"}},
+			},
+			wantApplied: []int{1, 1},
+			wantTab:     3, wantTitle: "c",
+		},
+		{
+			name:        "losing focus clears the tab",
+			batches:     [][]ExtensionEvent{{activated(100, 1, "a"), {Type: ExtEventWindowFocusLost, TS: 200}}},
+			wantApplied: []int{2},
+			wantTab:     0, wantTitle: "",
+		},
+		{
+			name:        "unknown event types are skipped",
+			batches:     [][]ExtensionEvent{{activated(100, 1, "a"), {Type: "tab_pinned", TS: 200, TabID: 2}}},
+			wantApplied: []int{1},
+			wantTab:     1, wantTitle: "a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetBrowser(t, "Test")
+			applied := []int{}
+			for _, batch := range test.batches {
+				applied = append(applied, applyEvents("Test", batch))
+			}
+			if !slices.Equal(applied, test.wantApplied) {
+				t.Errorf("applied %v, want %v", applied, test.wantApplied)
+			}
+
+			browserStatesMu.Lock()
+			tab := stateLocked("Test").Tab
+			browserStatesMu.Unlock()
+			if tab.TabID != test.wantTab || tab.Title != test.wantTitle {
+				t.Errorf("active tab %d %q, want %d %q", tab.TabID, tab.Title, test.wantTab, test.wantTitle)
+			}
+		})
+	}
+}
+
+func TestApplyEventsAudible(t *testing.T) {
+	resetBrowser(t, "Test")
+	applyEvents("Test", []ExtensionEvent{
+		{Type: ExtEventAudibleStopped, TS: 300, TabID: 4},
+		{Type: ExtEventAudibleStarted, TS: 100, TabID: 4},
+		{Type: ExtEventAudibleStarted, TS: 200, TabID: 5},
+	})
+	if isTabAudible("Test", 4) || !isTabAudible("Test", 5) {
+		t.Errorf("audible tabs 4=%v 5=%v, want only 5", isTabAudible("Test", 4), isTabAudible("Test", 5))
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"trackerdata"
+)
+
+// Placeholders recorded instead of excluded identities, so the time still counts
+const (
+	excludedAppName  = "Excluded app"
+	excludedSiteName = "Excluded site"
+)
+
+// exclusionsReloadInterval bounds how often exclusions.json is checked for edits
+const exclusionsReloadInterval = 10 * time.Second
+
+var (
+	exclusions   Exclusions
+	exclusionsMu sync.Mutex
+
+	exclusionsModTime time.Time
+	exclusionsChecked time.Time
+)
+
+// Exclusions lists apps and sites whose identity must never be written to disk.
+// It is kept in exclusions.json in the data folder and reloaded when the file changes.
+type Exclusions struct {
+	Apps  []string `json:"apps"`  // exe names, matched case-insensitively
+	Sites []string `json:"sites"` // domains, matching the domain itself and its subdomains
+}
+
+// exclusionsPath returns the location of exclusions.json
+func exclusionsPath() string {
+	return trackerdata.Path("exclusions.json")
+}
+
+// currentExclusions returns the exclusion list, reloading it if the file changed.
+// A missing file is created empty so it is easy to find and edit.
+func currentExclusions() Exclusions {
+	exclusionsMu.Lock()
+	defer exclusionsMu.Unlock()
+
+	if time.Since(exclusionsChecked) < exclusionsReloadInterval {
+		return exclusions
+	}
+	exclusionsChecked = time.Now()
+
+	path := exclusionsPath()
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		output, _ := json.MarshalIndent(Exclusions{Apps: []string{}, Sites: []string{}}, "", "  ")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, output, 0644); err != nil {
+			log.Printf("Exclusions error: %v", err)
+		}
+		return exclusions
+	}
+	if err != nil || info.ModTime().Equal(exclusionsModTime) {
+		return exclusions
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return exclusions
+	}
+	var loaded Exclusions
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		// Keep the previous list rather than recording everything because of a typo
+		log.Printf("Ignoring malformed exclusions.json: %v", err)
+		return exclusions
+	}
+	exclusions = loaded
+	exclusionsModTime = info.ModTime()
+	return exclusions
+}
+
+// isExcludedApp reports whether exeName is on the exclusion list
+func (e Exclusions) isExcludedApp(exeName string) bool {
+	for _, app := range e.Apps {
+		if strings.EqualFold(app, exeName) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcludedURL reports whether the URL's host is an excluded domain or one of its subdomains
+func (e Exclusions) isExcludedURL(rawURL string) bool {
+	host := strings.ToLower(trackerdata.Domain(rawURL))
+	if host == "" {
+		return false
+	}
+	for _, site := range e.Sites {
+		site = strings.ToLower(strings.TrimPrefix(site, "www."))
+		if host == site || strings.HasSuffix(host, "."+site) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyExclusions replaces excluded apps and sites in a reading with placeholders
+func applyExclusions(reading WindowReading) WindowReading {
+	excluded := currentExclusions()
+	if excluded.isExcludedApp(reading.ExePath) {
+		reading.ExePath = excludedAppName
+		reading.TabName = ""
+		reading.TabUrl = ""
+	} else if excluded.isExcludedURL(reading.TabUrl) {
+		reading.TabName = excludedSiteName
+		reading.TabUrl = ""
+	}
+	return reading
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsExcludedURL(t *testing.T) {
+	excluded := Exclusions{Sites: []string{"example.com", "www.Bank.test"}}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/", true},
+		{"https://a.example.com/page", true},
+		{"https://www.example.com", true},
+		{"https://EXAMPLE.com/", true},
+		{"https://badexample.com/", false},
+		{"https://example.com.evil.test/", false},
+		{"https://bank.test/login", true},
+		{"https://online.bank.test/", true},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := excluded.isExcludedURL(test.url); got != test.want {
+			t.Errorf("isExcludedURL(%q) = %v, want %v", test.url, got, test.want)
+		}
+	}
+}
+
+func TestIsExcludedApp(t *testing.T) {
+	excluded := Exclusions{Apps: []string{"KeePass.exe"}}
+	tests := []struct {
+		app  string
+		want bool
+	}{
+		{"KeePass.exe", true},
+		{"keepass.EXE", true},
+		{"KeePassXC.exe", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := excluded.isExcludedApp(test.app); got != test.want {
+			t.Errorf("isExcludedApp(%q) = %v, want %v", test.app, got, test.want)
+		}
+	}
+}
+
+func TestApplyExclusions(t *testing.T) {
+	// Set the list directly and mark it freshly checked so exclusions.json isn't read
+	exclusionsMu.Lock()
+	saved, savedChecked := exclusions, exclusionsChecked
+	exclusions = Exclusions{Apps: []string{"keepass.exe"}, Sites: []string{"example.com"}}
+	exclusionsChecked = time.Now()
+	exclusionsMu.Unlock()
+	t.Cleanup(func() {
+		exclusionsMu.Lock()
+		exclusions, exclusionsChecked = saved, savedChecked
+		exclusionsMu.Unlock()
+	})
+
+	tests := []struct {
+		name    string
+		reading WindowReading
+		want    WindowReading
+	}{
+		{
+			"excluded app",
+			WindowReading{ExePath: "KeePass.exe", TabName: "Vault", TabUrl: "https://example.org/"},
+			WindowReading{ExePath: excludedAppName},
+		},
+		{
+			"excluded subdomain",
+			WindowReading{ExePath: "firefox.exe", TabName: "Inbox", TabUrl: "https://mail.example.com/inbox"},
+			WindowReading{ExePath: "firefox.exe", TabName: excludedSiteName},
+		},
+		{
+			"similar domain",
+			WindowReading{ExePath: "firefox.exe", TabName: "Shop", TabUrl: "https://badexample.com/"},
+			WindowReading{ExePath: "firefox.exe", TabName: "Shop", TabUrl: "https://badexample.com/"},
+		},
+	}
+	for _, test := range tests {
+		got := applyExclusions(test.reading)
+		if got.ExePath != test.want.ExePath || got.TabName != test.want.TabName || got.TabUrl != test.want.TabUrl {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// extensionStatus returns a one-line summary of each paired browser's connection state
+func extensionStatus(now time.Time) string {
+	configMu.Lock()
+	names := []string{}
+	seen := map[string]bool{}
+	for _, ext := range config.Extensions {
+		if !seen[ext.Browser] {
+			seen[ext.Browser] = true
+			names = append(names, ext.Browser)
+		}
+	}
+	configMu.Unlock()
+
+	if len(names) == 0 {
+		return "Browser extension: not paired"
+	}
+
+	browserStatesMu.Lock()
+	defer browserStatesMu.Unlock()
+
+	parts := []string{}
+	for _, name := range names {
+		state := stateLocked(name)
+		switch {
+		case state.LastSeen.IsZero():
+			parts = append(parts, name+" not connected")
+		case state.stale(now):
+			parts = append(parts, name+" quiet since "+state.LastSeen.Format("15:04"))
+		default:
+			parts = append(parts, name+" connected")
+		}
+	}
+	return "Browser extension: " + strings.Join(parts, ", ")
+}
+
+// runExtensionStatusMenu keeps the status menu item in sync with the extensions' connection state
+func runExtensionStatusMenu(item *systray.MenuItem) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		status := extensionStatus(time.Now())
+		if status != last {
+			item.SetTitle(status)
+			log.Print(status)
+			last = status
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"trackerdata"
+)
+
+// heartbeatState is the content of the heartbeat file. The file exists only while a collector is running,
+// so finding one at startup means the previous run never reached onExit.
+type heartbeatState struct {
+	PID  int       `json:"pid"`
+	At   time.Time `json:"at"`             // last time the collector was known to be alive
+	Open *Span     `json:"open,omitempty"` // span that was open at that time
+}
+
+// heartbeatPath returns the location of the heartbeat file
+func heartbeatPath() string {
+	return trackerdata.Path("collector.heartbeat")
+}
+
+var (
+	heartbeatStop = make(chan struct{}) // closed to stop heartbeatLoop
+	heartbeatDone = make(chan struct{}) // closed once heartbeatLoop has returned
+)
+
+// heartbeatLoop refreshes the heartbeat file every heartbeatInterval until stopHeartbeat is called
+func heartbeatLoop() {
+	defer close(heartbeatDone)
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		writeHeartbeat()
+		select {
+		case <-heartbeatStop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stopHeartbeat stops heartbeatLoop and waits for a write in progress to finish, so the file can't be
+// written again after clearHeartbeat removes it
+func stopHeartbeat() {
+	close(heartbeatStop)
+	<-heartbeatDone
+}
+
+// writeHeartbeat records the current time and open span. The file is replaced atomically so a crash
+// mid-write never leaves a truncated heartbeat behind.
+func writeHeartbeat() {
+	state := heartbeatState{
+		PID:  os.Getpid(),
+		At:   time.Now(),
+		Open: spans.snapshot(),
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+
+	path := heartbeatPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("Heartbeat error: %v", err)
+		return
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		log.Printf("Heartbeat error: %v", err)
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		log.Printf("Heartbeat error: %v", err)
+	}
+}
+
+// clearHeartbeat removes the heartbeat file after a clean exit
+func clearHeartbeat() {
+	os.Remove(heartbeatPath())
+}
+
+// recoverUncleanExit closes out a previous run that left its heartbeat file behind. The span that was
+// open is written as ending at the last heartbeat, followed by a crash-recovered marker at the same time,
+// both into the files of the days they belong to.
+func recoverUncleanExit() {
+	data, err := os.ReadFile(heartbeatPath())
+	if err != nil {
+		return
+	}
+	clearHeartbeat()
+
+	var state heartbeatState
+	if err := json.Unmarshal(data, &state); err != nil || state.At.IsZero() {
+		log.Printf("Discarding unreadable heartbeat file: %v", err)
+		return
+	}
+
+	if state.Open != nil && state.At.After(state.Open.Start) {
+		state.Open.End = state.At
+		storeSpan(*state.Open)
+	}
+	recordSessionEvent(EventCrashRecovered, state.At)
+}
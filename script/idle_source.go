@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// idleSourceEnv overrides automatic idle backend detection (e.g. "hook")
+const idleSourceEnv = "TRACKER_IDLE_SOURCE"
+
+// idleSource reports time since the last user input, chosen in onReady
+var idleSource IdleSource
+
+// IdleSource reports how long the user has gone without keyboard or mouse input
+type IdleSource interface {
+	IdleTime() (time.Duration, error)
+}
+
+// openIdleSource returns the backend named by TRACKER_IDLE_SOURCE, or the platform default.
+// If the platform query is unavailable the global input hook is used instead.
+func openIdleSource() IdleSource {
+	name := os.Getenv(idleSourceEnv)
+	if name == "hook" {
+		return newHookIdleSource()
+	}
+	source, err := newIdleSource(name)
+	if err != nil {
+		log.Printf("Idle source unavailable (%v), falling back to input hook", err)
+		return newHookIdleSource()
+	}
+	return source
+}
+
+// hookIdleSource derives idle time from the global gohook event stream.
+// It is heavier than asking the OS, but works anywhere gohook does.
+type hookIdleSource struct {
+	hook *inputHook
+}
+
+// newHookIdleSource starts the global input hook and returns a source fed by it
+func newHookIdleSource() *hookIdleSource {
+	return &hookIdleSource{hook: startInputHook()}
+}
+
+// IdleTime returns the time since the hook last saw an event
+func (s *hookIdleSource) IdleTime() (time.Duration, error) {
+	s.hook.mu.Lock()
+	defer s.hook.mu.Unlock()
+	return time.Since(s.hook.lastInput), nil
+}
+
+// checkActivity reports whether there was input within inactiveThreshold, and when the last input was
+func checkActivity() (bool, time.Time) {
+	now := time.Now()
+	idle, err := idleSource.IdleTime()
+	if err != nil {
+		return false, now
+	}
+	return idle < inactiveThreshold, now.Add(-idle)
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newIdleSource reports that this platform has no native idle query, so the input hook is used
+func newIdleSource(name string) (IdleSource, error) {
+	return nil, fmt.Errorf("no idle source available on %s", runtime.GOOS)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procGetLastInputInfo = windows.NewLazySystemDLL("user32.dll").NewProc("GetLastInputInfo")
+	procGetTickCount     = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetTickCount")
+)
+
+// lastInputInfo mirrors the Win32 LASTINPUTINFO struct
+type lastInputInfo struct {
+	cbSize uint32
+	dwTime uint32
+}
+
+// win32IdleSource reads the session idle time through GetLastInputInfo
+type win32IdleSource struct{}
+
+// newIdleSource returns the GetLastInputInfo source; Windows has a single native backend
+func newIdleSource(name string) (IdleSource, error) {
+	if name != "" && name != "win32" {
+		return nil, fmt.Errorf("unknown idle source %q", name)
+	}
+	return win32IdleSource{}, nil
+}
+
+// IdleTime returns the time since the last keyboard or mouse input in this session
+func (win32IdleSource) IdleTime() (time.Duration, error) {
+	info := lastInputInfo{cbSize: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	ok, _, err := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info)))
+	if ok == 0 {
+		return 0, err
+	}
+
+	// Both values are in milliseconds since boot and wrap together after ~49 days
+	now, _, _ := procGetTickCount.Call()
+	return time.Duration(uint32(now)-info.dwTime) * time.Millisecond, nil
+}
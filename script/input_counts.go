@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"time"
+	"trackerdata"
+
+	hook "github.com/robotn/gohook"
+)
+
+// inputCounter tallies input events between readings, started in onReady when count_input is enabled
+var inputCounter *inputHook
+
+// InputCounts is the number of input events over an interval, as stored in span files
+type InputCounts = trackerdata.InputCounts
+
+// addInput sums two counts into a new value. Nil means input wasn't counted.
+func addInput(a, b *InputCounts) *InputCounts {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &InputCounts{
+		Keys:    a.Keys + b.Keys,
+		Clicks:  a.Clicks + b.Clicks,
+		Scrolls: a.Scrolls + b.Scrolls,
+	}
+}
+
+var (
+	sharedHook     *inputHook
+	sharedHookOnce sync.Once
+)
+
+// inputHook consumes the global gohook event stream. gohook can only run once per process,
+// so the hook idle source and input counting share it.
+type inputHook struct {
+	mu        sync.Mutex
+	lastInput time.Time
+	counts    InputCounts
+	running   bool // the hook reported that it started, so zero counts mean no input
+}
+
+// startInputHook starts the global input hook on first use and returns it
+func startInputHook() *inputHook {
+	sharedHookOnce.Do(func() {
+		sharedHook = &inputHook{lastInput: time.Now()}
+		go sharedHook.run()
+	})
+	return sharedHook
+}
+
+// run records the time of every input event and counts key presses, clicks and scroll steps
+func (h *inputHook) run() {
+	evChan := hook.Start()
+	defer hook.End()
+
+	for ev := range evChan {
+		h.mu.Lock()
+		switch ev.Kind {
+		case hook.HookEnabled:
+			h.running = true
+		case hook.HookDisabled:
+			h.running = false
+		case hook.KeyUp:
+			// Count releases rather than presses so held keys aren't counted once per repeat
+			h.counts.Keys++
+		case hook.MouseUp:
+			h.counts.Clicks++
+		case hook.MouseWheel:
+			h.counts.Scrolls++
+		}
+		if ev.Kind != hook.HookEnabled && ev.Kind != hook.HookDisabled {
+			h.lastInput = time.Now()
+		}
+		h.mu.Unlock()
+	}
+}
+
+// take returns the input counted since the last call, or nil if the hook isn't running
+func (h *inputHook) take() *InputCounts {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.running {
+		return nil
+	}
+	counts := h.counts
+	h.counts = InputCounts{}
+	return &counts
+}
+
+// takeInputCounts returns the input counted since the previous reading, or nil if input isn't counted
+func takeInputCounts() *InputCounts {
+	if inputCounter == nil {
+		return nil
+	}
+	return inputCounter.take()
+}
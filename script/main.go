@@ -2,24 +2,19 @@ package main
 
 import (
 	_ "embed"
-	"encoding/csv"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strings"
-	"sync"
 	"time"
+	"trackerdata"
 
 	"github.com/getlantern/systray"
-	hook "github.com/robotn/gohook"
-	"golang.org/x/sys/windows"
 
 	// vestigial imports for keyboard functionality
 	_ "os/signal"
-	_ "strconv"
 	_ "syscall"
 
 	_ "github.com/eiannone/keyboard"
@@ -29,21 +24,16 @@ import (
 var iconBytes []byte
 
 const (
-	httpPort          = "8384"
-	chromeExtensionID = "YOUR_CHROME_EXTENSION_ID"
-	// firefoxExtensionID   = "@jwtabtracker_local"
-	firefoxExtensionID = "583a7b7a-defb-4431-8771-cee0ca64931a"
+	httpPort = "8384"
 
-	allowedOriginChrome  = "chrome-extension://" + chromeExtensionID
-	allowedOriginFirefox = "moz-extension://" + firefoxExtensionID
-)
-
-var (
-	currentTab   TabInfo
-	currentTabMu sync.Mutex
+	pollInterval       = time.Second      // how often the focused window is sampled
+	checkpointInterval = time.Minute      // how often an open span is checkpointed to disk
+	heartbeatInterval  = 10 * time.Second // how often the heartbeat file is refreshed
+	inactiveThreshold  = 2 * time.Minute  // idle time after which the user counts as inactive
+	maxPollGap         = 15 * time.Second // a longer gap between samples means the machine slept
 
-	hadActivitySinceLastCheck bool
-	activityMu                sync.Mutex
+	extensionHeartbeatInterval = 30 * time.Second // how often the extension confirms its active tab
+	staleTabWindow             = 90 * time.Second // tab state older than this is treated as unknown
 )
 
 type WindowReading struct {
@@ -52,133 +42,104 @@ type WindowReading struct {
 	TabUrl      string
 	Timestamp   time.Time
 	HadActivity bool
+	Audible     bool         // the focused tab or app is playing sound
+	LastInput   time.Time    // time of the most recent keyboard or mouse input
+	Input       *InputCounts // input since the previous reading, nil if input isn't counted
 }
 
 // TabInfo represents the data received from the browser extension
 type TabInfo struct {
-	TabID int64  `json:"tabId"`
-	Title string `json:"title"`
-	URL   string `json:"url"`
-	TS    int64  `json:"ts"`
+	TabID     int64  `json:"tabId"`
+	WindowID  int64  `json:"windowId"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Incognito bool   `json:"incognito"`
+	TS        int64  `json:"ts"`
 }
 
 // getFocusedWindowInfo retrieves the exe path of the currently focused window
 func getFocusedWindowInfo() (WindowReading, error) {
-	// Check for activity since last call
-	hadActivity := checkAndResetActivity()
-
-	hwnd := windows.GetForegroundWindow()
-
-	// Get process ID from window handle
-	var pid uint32
-	_, _ = windows.GetWindowThreadProcessId(hwnd, &pid)
+	// Check for recent activity
+	hadActivity, lastInput := checkActivity()
+	input := takeInputCounts()
 
-	// Get executable path from PID
-	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	window, err := windowSource.FocusedWindow()
 	if err != nil {
 		return WindowReading{}, err
 	}
-	defer windows.CloseHandle(handle)
+	exeName := exeBaseName(window.ExePath)
 
-	var buf [windows.MAX_PATH]uint16
-	length := uint32(len(buf))
-	err = windows.QueryFullProcessImageName(handle, 0, &buf[0], &length)
-	if err != nil {
-		return WindowReading{}, err
-	}
-	exePath := windows.UTF16ToString(buf[:length])
-	parts := strings.Split(exePath, "\\")
-	exeName := parts[len(parts)-1]
-
-	browserNames := []string{"chrome.exe", "firefox.exe"}
+	// Use the tab of the browser that is actually focused
 	tabName := ""
 	tabUrl := ""
-
-	for _, v := range browserNames {
-		if exeName == v {
-			currentTabMu.Lock()
-			tabName = currentTab.Title
-			tabUrl = currentTab.URL
-			currentTabMu.Unlock()
-			break
+	audible := false
+	if browser, ok := browserForExe(exeName); ok {
+		tab, keep := applyIncognitoPolicy(getTab(browser.Name))
+		if !keep {
+			return WindowReading{}, errReadingDropped
 		}
+		tabName = tab.Title
+		tabUrl = tab.URL
+		audible = isTabAudible(browser.Name, tab.TabID)
+	}
+	if !audible {
+		audible = isExePlayingAudio(exeName)
 	}
 
-	return WindowReading{
+	// Redact excluded apps and sites, then scrub titles and URLs, before the reading goes anywhere near the disk
+	return applyRedaction(applyExclusions(WindowReading{
 		ExePath:     exeName,
 		TabName:     tabName,
 		TabUrl:      tabUrl,
 		Timestamp:   time.Now(),
 		HadActivity: hadActivity,
-	}, nil
+		Audible:     audible,
+		LastInput:   lastInput,
+		Input:       input,
+	})), nil
 }
 
-// startActivityMonitor starts a global event hook to detect mouse and keyboard activity
-func startActivityMonitor() {
-	evChan := hook.Start()
-	defer hook.End()
+func main() {
+	dataDir := flag.String("data-dir", "", "folder to keep tracked data in (default $"+trackerdata.DirEnv+" or the per-user data folder)")
+	flag.Parse()
+	trackerdata.SetDir(*dataDir)
 
-	for range evChan {
-		activityMu.Lock()
-		hadActivitySinceLastCheck = true
-		activityMu.Unlock()
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
 	}
+	systray.Run(onReady, onExit)
 }
 
-// checkAndResetActivity checks if there was activity since last check and resets the flag
-func checkAndResetActivity() bool {
-	activityMu.Lock()
-	defer activityMu.Unlock()
-
-	result := hadActivitySinceLastCheck
-	hadActivitySinceLastCheck = false
-	return result
-}
-
-// storeReading persists a window reading
-func storeReading(reading WindowReading) {
-	// create data folder in AppData/Local
-	data_dir := filepath.Join(os.Getenv("LOCALAPPDATA"), "tracker_data")
-	err := os.MkdirAll(data_dir, 0755)
+func onReady() {
+	config = loadConfig()
+	source, err := openWindowSource()
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	// create or append to file named by date
-	today := time.Now().Format("20060102")
-	data_file_path := filepath.Join(data_dir, today+".csv")
-
-	// check if file exists to determine if we need headers
-	isNew := false
-	if _, err := os.Stat(data_file_path); os.IsNotExist(err) {
-		isNew = true
-	}
-
-	f, err := os.OpenFile(data_file_path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		log.Fatal(err)
+	windowSource = source
+	r, errs := NewRedactor(config.Redaction)
+	for _, err := range errs {
+		log.Printf("Config error: %v", err)
 	}
-	defer f.Close()
+	redactor = r
 
-	writer := csv.NewWriter(f)
-	defer writer.Flush()
+	systray.SetIcon(iconBytes)
+	systray.SetTitle("Tracker")
+	systray.SetTooltip("Window Tracker")
 
-	// write header if new file
-	if isNew {
-		writer.Write([]string{"name", "timestamp", "tabName", "tabUrl", "hadActivity"})
-	}
+	runPauseMenu()
 
-	writer.Write([]string{reading.ExePath, reading.Timestamp.Format(time.RFC3339), reading.TabName, reading.TabUrl, fmt.Sprintf("%t", reading.HadActivity)})
-}
+	mPair := systray.AddMenuItem("Pair browser extension", "Show a one-time code to pair the browser extension")
+	go runPairingMenu(mPair)
 
-func main() {
-	systray.Run(onReady, onExit)
-}
+	mExtension := systray.AddMenuItem("Browser extension: not connected", "Connection state of paired browser extensions")
+	mExtension.Disable()
+	go runExtensionStatusMenu(mExtension)
 
-func onReady() {
-	systray.SetIcon(iconBytes)
-	systray.SetTitle("Tracker")
-	systray.SetTooltip("Window Tracker")
+	mStorage := systray.AddMenuItem("Saving data", "Problems saving tracked data")
+	mStorage.Disable()
+	mStorage.Hide()
+	go runStorageStatusMenu(mStorage)
 
 	mQuit := systray.AddMenuItem("Exit", "Exit the tracker")
 
@@ -189,7 +150,24 @@ func onReady() {
 	}()
 
 	// Start activity monitor
-	go startActivityMonitor()
+	idleSource = openIdleSource()
+	if config.CountInput {
+		inputCounter = startInputHook()
+	}
+	if source, err := newAudioSource(); err == nil {
+		audioSource = source
+	} else {
+		log.Printf("Audio source unavailable: %v", err)
+	}
+
+	// Close out a previous run that never wrote its exit marker, write spans in the background, maintain
+	// old days once the recovered spans are written, and watch for sleep and lock
+	storage.setBackend(config.Storage.Backend)
+	recoverUncleanExit()
+	go runStorage(config.Storage)
+	go runMaintenance(config.Compaction, config.Retention)
+	startSessionMonitor()
+	go heartbeatLoop()
 
 	// Start tracking loop
 	go trackingLoop()
@@ -199,33 +177,37 @@ func onReady() {
 }
 
 func onExit() {
-	storeReading(WindowReading{
-		ExePath:   "Off",
-		Timestamp: time.Now(),
-	})
+	recordSessionEvent(EventOff, time.Now())
+	closeStorage()
+	stopHeartbeat()
+	clearHeartbeat()
 }
 
 func trackingLoop() {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
-	// Take an initial reading immediately
-	if reading, err := getFocusedWindowInfo(); err == nil {
-		storeReading(reading)
-	}
-
+	// Sample on every tick, and immediately whenever the browser reports a tab change
 	for {
-		<-ticker.C
 		reading, err := getFocusedWindowInfo()
-		if err != nil {
-			continue
+		if err == nil {
+			spans.observe(reading)
+		} else if errors.Is(err, errReadingDropped) {
+			// Don't let the previous span run on through time that must not be recorded
+			spans.interrupt(time.Now())
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stateChanged:
 		}
-		storeReading(reading)
 	}
 }
 
 func startHTTPServer() {
+	http.HandleFunc("/pair", pairHandler)
 	http.HandleFunc("/tab", tabHandler)
+	http.HandleFunc("/v2/events", eventsHandler)
 	addr := "127.0.0.1:" + httpPort
 	log.Printf("Starting HTTP server on %s", addr)
 	if err := http.ListenAndServe(addr, nil); err != nil {
@@ -234,30 +216,8 @@ func startHTTPServer() {
 }
 
 func tabHandler(w http.ResponseWriter, r *http.Request) {
-	origin := r.Header.Get("Origin")
-
-	// Validate origin
-	if origin != allowedOriginChrome && origin != allowedOriginFirefox {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		log.Printf("Wrong origin: %v", origin)
-		return
-	}
-
-	print("Received tab info from origin: ", origin, "\n")
-
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", origin)
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	// Handle preflight request
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	ext, ok := authorizeExtensionRequest(w, r)
+	if !ok {
 		return
 	}
 
@@ -267,9 +227,8 @@ func tabHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentTabMu.Lock()
-	currentTab = tabInfo
-	currentTabMu.Unlock()
+	setTab(ext.Browser, tabInfo)
+	notifyStateChanged()
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status":"ok"}`))
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"time"
+	"trackerdata"
+)
+
+// maintenanceInterval is how often the collector compacts old days and applies the retention policy while it runs
+const maintenanceInterval = 24 * time.Hour
+
+// CompactionConfig sets when old day files are replaced by compacted ones
+type CompactionConfig struct {
+	AfterDays int `json:"after_days"` // compact days at least this many days old; 0 turns compaction off
+}
+
+// RetentionConfig sets how long titles, full URLs and individual spans are kept
+type RetentionConfig = trackerdata.RetentionPolicy
+
+// compactionCutoff returns the YYYYMMDD before which days are compacted, in the recording zone
+func compactionCutoff(afterDays int) string {
+	_, loc := recordingZone()
+	return time.Now().In(loc).AddDate(0, 0, -afterDays).Format("20060102")
+}
+
+// today returns the current YYYYMMDD date in the recording zone
+func today() string {
+	_, loc := recordingZone()
+	return time.Now().In(loc).Format("20060102")
+}
+
+// maintenanceLimit returns the first YYYYMMDD that maintenance leaves alone: today, or the day the open span
+// started on if that is earlier, since its checkpoints are still written to that day. Spans that close later
+// started on this day or after it.
+func maintenanceLimit() string {
+	limit := today()
+	if open := spans.snapshot(); open != nil {
+		limit = min(limit, open.record().Day())
+	}
+	return limit
+}
+
+// retentionDate returns the YYYYMMDD date the retention policy is applied as of: today, or an earlier date if
+// the policy would otherwise rewrite days from limit on. The days held back are rewritten on a later run.
+func retentionDate(policy RetentionConfig, today string, limit string) string {
+	date, err := time.Parse("20060102", today)
+	if err != nil {
+		return today
+	}
+	until, err := time.Parse("20060102", limit)
+	if err != nil {
+		return today
+	}
+	for _, days := range []int{policy.StripTitlesAfterDays, policy.DomainsOnlyAfterDays, policy.AggregateAfterDays} {
+		if cutoff := date.AddDate(0, 0, -days); days > 0 && cutoff.After(until) {
+			date = date.Add(until.Sub(cutoff))
+		}
+	}
+	return date.Format("20060102")
+}
+
+// runMaintenance compacts old days and applies the retention policy at startup and then once a day. Each run
+// first writes the queued spans, such as those recovered after a crash, then works on a store of its own
+// while the collector keeps writing, and never touches the day the open span started on or later.
+// Compaction goes first so that retention rewrites compacted days rather than raw ones.
+func runMaintenance(compaction CompactionConfig, retention RetentionConfig) {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+	for {
+		limit := maintenanceLimit()
+		if err := syncStorage(); err != nil {
+			log.Printf("Maintenance postponed until queued spans are written: %v", err)
+			time.Sleep(time.Minute)
+			continue
+		}
+		if compaction.AfterDays > 0 {
+			compactOldDays(min(compactionCutoff(compaction.AfterDays), limit))
+		}
+		applyRetention(retention, limit)
+		<-ticker.C
+	}
+}
+
+// compactOldDays compacts the days before the given YYYYMMDD and logs the outcome
+func compactOldDays(before string) {
+	results, err := trackerdata.CompactDayFiles(trackerdata.Dir(), before, false)
+	if err != nil {
+		log.Printf("Compaction error: %v", err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			log.Printf("Compaction of %s failed: %v", result.Day, result.Err)
+		} else {
+			log.Printf("Compacted %s into %d spans", result.Day, result.Spans)
+		}
+	}
+}
+
+// applyRetention enforces the retention policy on the days before limit and logs the outcome
+func applyRetention(policy RetentionConfig, limit string) {
+	if policy == (RetentionConfig{}) {
+		return
+	}
+	store, err := storage.open()
+	if err != nil {
+		log.Printf("Retention error: %v", err)
+		return
+	}
+	defer store.Close()
+
+	results, err := trackerdata.ApplyRetention(store, policy, retentionDate(policy, today(), limit), false)
+	if err != nil {
+		log.Printf("Retention error: %v", err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			log.Printf("Retention for %s failed: %v", result.Day, result.Err)
+		} else {
+			log.Printf("Retention: %s", describeRetention(result))
+		}
+	}
+}
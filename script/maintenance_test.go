@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestRetentionDate(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       RetentionConfig
+		today, limit string
+		want         string
+	}{
+		{"open span started today", RetentionConfig{AggregateAfterDays: 1}, "20240310", "20240310", "20240310"},
+		{"open span on the last day kept", RetentionConfig{AggregateAfterDays: 1}, "20240310", "20240309", "20240310"},
+		{"open span on a day to rewrite", RetentionConfig{StripTitlesAfterDays: 1, AggregateAfterDays: 30}, "20240310", "20240308", "20240309"},
+		{"open span on a recent day", RetentionConfig{StripTitlesAfterDays: 3}, "20240310", "20240309", "20240310"},
+		{"held back across a leap day", RetentionConfig{DomainsOnlyAfterDays: 2}, "20240302", "20240227", "20240229"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retentionDate(test.policy, test.today, test.limit); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+const (
+	pairingCodeTTL      = 5 * time.Minute
+	maxPairingAttempts  = 5           // wrong codes after which the shown code is thrown away
+	pairAttemptInterval = time.Second // minimum time between attempts on /pair
+)
+
+var (
+	// pairing holds the one-time code currently shown in the systray, if any
+	pairing   pairingCode
+	pairingMu sync.Mutex
+
+	// lastPairAttempt is when /pair last checked a code, guarded by pairingMu
+	lastPairAttempt time.Time
+)
+
+// pairingCode is a one-time code the user copies from the systray into the extension
+type pairingCode struct {
+	code     string
+	expires  time.Time
+	failures int // wrong codes submitted while this one was shown
+}
+
+// TrustedExtension is a paired extension instance. The token itself is never stored, only its hash.
+type TrustedExtension struct {
+	Origin    string    `json:"origin"`    // e.g. chrome-extension://<id> or moz-extension://<uuid>
+	Browser   string    `json:"browser"`   // BrowserConfig.Name whose tab state this extension reports
+	TokenHash string    `json:"tokenHash"` // hex SHA-256 of the bearer token
+	PairedAt  time.Time `json:"pairedAt"`
+}
+
+// pairRequest is the body of POST /pair
+type pairRequest struct {
+	Code    string `json:"code"`
+	Browser string `json:"browser"`
+}
+
+// isExtensionOrigin reports whether an Origin header belongs to a browser extension
+func isExtensionOrigin(origin string) bool {
+	return strings.HasPrefix(origin, "chrome-extension://") || strings.HasPrefix(origin, "moz-extension://")
+}
+
+// hashToken returns the hex SHA-256 of a bearer token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// startPairing generates a new six-digit code, replacing any previous one
+func startPairing() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	pairingMu.Lock()
+	defer pairingMu.Unlock()
+	pairing = pairingCode{code: code, expires: time.Now().Add(pairingCodeTTL)}
+	return code, nil
+}
+
+// consumePairingCode checks a submitted code and invalidates it on success. After maxPairingAttempts
+// wrong codes it is invalidated too, so the six digits can't be guessed while the code is shown.
+func consumePairingCode(code string) bool {
+	pairingMu.Lock()
+	defer pairingMu.Unlock()
+
+	if pairing.code == "" || time.Now().After(pairing.expires) {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(pairing.code), []byte(code)) != 1 {
+		pairing.failures++
+		if pairing.failures >= maxPairingAttempts {
+			log.Printf("Pairing code discarded after %d wrong attempts", pairing.failures)
+			pairing = pairingCode{}
+		}
+		return false
+	}
+	pairing = pairingCode{}
+	return true
+}
+
+// allowPairAttempt reports whether a code may be checked now, at most one every pairAttemptInterval
+func allowPairAttempt() bool {
+	pairingMu.Lock()
+	defer pairingMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(lastPairAttempt) < pairAttemptInterval {
+		return false
+	}
+	lastPairAttempt = now
+	return true
+}
+
+// pairingActive reports whether the code shown in the systray is still usable
+func pairingActive() bool {
+	pairingMu.Lock()
+	defer pairingMu.Unlock()
+	return pairing.code != "" && time.Now().Before(pairing.expires)
+}
+
+// authenticateExtension returns the trusted extension matching the request's Origin and bearer token
+func authenticateExtension(r *http.Request) (TrustedExtension, bool) {
+	origin := r.Header.Get("Origin")
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return TrustedExtension{}, false
+	}
+	tokenHash := hashToken(token)
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	for _, ext := range config.Extensions {
+		if ext.Origin == origin && subtle.ConstantTimeCompare([]byte(ext.TokenHash), []byte(tokenHash)) == 1 {
+			return ext, true
+		}
+	}
+	return TrustedExtension{}, false
+}
+
+// setExtensionCORS sets the CORS headers for an extension origin and reports whether the request was a preflight
+func setExtensionCORS(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return true
+	}
+	return false
+}
+
+// authorizeExtensionRequest handles CORS and authentication shared by the extension endpoints.
+// It returns false once a response has been written (preflight or error).
+func authorizeExtensionRequest(w http.ResponseWriter, r *http.Request) (TrustedExtension, bool) {
+	origin := r.Header.Get("Origin")
+
+	// Preflight requests carry no credentials, so only the origin format is checked for them
+	if !isExtensionOrigin(origin) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		log.Printf("Wrong origin: %v", origin)
+		return TrustedExtension{}, false
+	}
+
+	if setExtensionCORS(w, r) {
+		return TrustedExtension{}, false
+	}
+
+	ext, ok := authenticateExtension(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Printf("Unpaired extension: %v", origin)
+		return TrustedExtension{}, false
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return TrustedExtension{}, false
+	}
+	return ext, true
+}
+
+// pairHandler exchanges the one-time code for a bearer token and trusts the calling extension
+func pairHandler(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if !isExtensionOrigin(origin) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		log.Printf("Wrong origin: %v", origin)
+		return
+	}
+
+	if setExtensionCORS(w, r) {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req pairRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !allowPairAttempt() {
+		http.Error(w, "Too many pairing attempts, try again in a moment", http.StatusTooManyRequests)
+		return
+	}
+	if !consumePairingCode(strings.TrimSpace(req.Code)) {
+		http.Error(w, "Invalid or expired pairing code", http.StatusUnauthorized)
+		log.Printf("Rejected pairing attempt from %v", origin)
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	// Fall back to the first browser using this extension format when the extension can't tell
+	browser := req.Browser
+	if browser == "" {
+		browser = "Chrome"
+		if strings.HasPrefix(origin, "moz-extension://") {
+			browser = "Firefox"
+		}
+	}
+
+	if err := trustExtension(TrustedExtension{
+		Origin:    origin,
+		Browser:   browser,
+		TokenHash: hashToken(token),
+		PairedAt:  time.Now(),
+	}); err != nil {
+		log.Printf("Config error: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Paired %s extension from %v", browser, origin)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"token": token, "browser": browser})
+}
+
+// trustExtension adds a paired extension to the config, replacing an earlier pairing of the same origin and browser
+func trustExtension(ext TrustedExtension) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	extensions := []TrustedExtension{}
+	for _, existing := range config.Extensions {
+		if existing.Origin != ext.Origin || existing.Browser != ext.Browser {
+			extensions = append(extensions, existing)
+		}
+	}
+	config.Extensions = append(extensions, ext)
+	return saveConfig(config)
+}
+
+// runPairingMenu shows a fresh pairing code in the menu item each time it is clicked,
+// and restores the item once the code is used or expires
+func runPairingMenu(item *systray.MenuItem) {
+	const idleTitle = "Pair browser extension"
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	showing := false
+	for {
+		select {
+		case <-item.ClickedCh:
+			code, err := startPairing()
+			if err != nil {
+				log.Printf("Pairing error: %v", err)
+				continue
+			}
+			item.SetTitle("Pairing code: " + code)
+			item.SetTooltip("Enter this code in the extension popup within 5 minutes")
+			showing = true
+		case <-ticker.C:
+			if showing && !pairingActive() {
+				item.SetTitle(idleTitle)
+				item.SetTooltip("Show a one-time code to pair the browser extension")
+				showing = false
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsumePairingCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts []string
+		want     []bool
+	}{
+		{"right code", []string{"123456"}, []bool{true}},
+		{"used once", []string{"123456", "123456"}, []bool{true, false}},
+		{"right after a few wrong", []string{"000000", "111111", "123456"}, []bool{false, false, true}},
+		{"discarded after too many wrong", []string{"000000", "000001", "000002", "000003", "000004", "123456"},
+			[]bool{false, false, false, false, false, false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pairingMu.Lock()
+			pairing = pairingCode{code: "123456", expires: time.Now().Add(pairingCodeTTL)}
+			pairingMu.Unlock()
+
+			for i, code := range test.attempts {
+				if got := consumePairingCode(code); got != test.want[i] {
+					t.Errorf("attempt %d with %s = %v, want %v", i+1, code, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPairHandlerRateLimit(t *testing.T) {
+	pairingMu.Lock()
+	pairing = pairingCode{code: "123456", expires: time.Now().Add(pairingCodeTTL)}
+	lastPairAttempt = time.Time{}
+	pairingMu.Unlock()
+
+	attempt := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/pair", strings.NewReader(`{"code":"000000"}`))
+		r.Header.Set("Origin", "chrome-extension://abc")
+		w := httptest.NewRecorder()
+		pairHandler(w, r)
+		return w.Code
+	}
+	if code := attempt(); code != http.StatusUnauthorized {
+		t.Errorf("first attempt: got status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := attempt(); code != http.StatusTooManyRequests {
+		t.Errorf("immediate second attempt: got status %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// The rate-limited attempt wasn't checked, so only one wrong code counts against the shown one
+	pairingMu.Lock()
+	failures := pairing.failures
+	pairingMu.Unlock()
+	if failures != 1 {
+		t.Errorf("got %d failures, want 1", failures)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+var (
+	// pauseTimer resumes tracking at the end of a timed pause; nil when not paused or paused until resumed
+	pauseTimer  *time.Timer
+	paused      bool
+	pausedUntil time.Time // zero when paused until resumed
+	pauseMu     sync.Mutex
+
+	// pauseChanged tells the systray menu to refresh after a pause starts or ends
+	pauseChanged = make(chan struct{}, 1)
+)
+
+// pauseTracking stops recording for d, or until resumeTracking is called if d is 0
+func pauseTracking(d time.Duration) {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+
+	if pauseTimer != nil {
+		pauseTimer.Stop()
+		pauseTimer = nil
+	}
+	if !paused {
+		recordSessionEvent(EventTrackingPaused, time.Now())
+		paused = true
+	}
+	pausedUntil = time.Time{}
+	if d > 0 {
+		pauseTimer = time.AfterFunc(d, resumeTracking)
+		pausedUntil = time.Now().Add(d)
+	}
+	notifyPauseChanged()
+}
+
+// resumeTracking ends a pause, if one is active
+func resumeTracking() {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+
+	if pauseTimer != nil {
+		pauseTimer.Stop()
+		pauseTimer = nil
+	}
+	if paused {
+		recordSessionEvent(EventTrackingResumed, time.Now())
+		paused = false
+	}
+	notifyPauseChanged()
+}
+
+func notifyPauseChanged() {
+	select {
+	case pauseChanged <- struct{}{}:
+	default:
+	}
+}
+
+// runPauseMenu adds the pause submenu and a resume item, and keeps them in sync with the pause state
+func runPauseMenu() {
+	mPause := systray.AddMenuItem("Pause tracking", "Stop recording for a while")
+	m15 := mPause.AddSubMenuItem("For 15 minutes", "Resume automatically after 15 minutes")
+	m60 := mPause.AddSubMenuItem("For 1 hour", "Resume automatically after 1 hour")
+	mUntil := mPause.AddSubMenuItem("Until resumed", "Stay paused until resumed from this menu")
+	mResume := systray.AddMenuItem("Resume tracking", "Start recording again")
+	mResume.Hide()
+
+	go func() {
+		for {
+			select {
+			case <-m15.ClickedCh:
+				pauseTracking(15 * time.Minute)
+			case <-m60.ClickedCh:
+				pauseTracking(time.Hour)
+			case <-mUntil.ClickedCh:
+				pauseTracking(0)
+			case <-mResume.ClickedCh:
+				resumeTracking()
+			}
+		}
+	}()
+
+	go func() {
+		for range pauseChanged {
+			pauseMu.Lock()
+			isPaused, until := paused, pausedUntil
+			pauseMu.Unlock()
+
+			if isPaused {
+				if until.IsZero() {
+					mPause.SetTitle("Paused until resumed")
+				} else {
+					mPause.SetTitle("Paused until " + until.Format("15:04"))
+				}
+				mResume.Show()
+				systray.SetTooltip("Window Tracker (paused)")
+			} else {
+				mPause.SetTitle("Pause tracking")
+				mResume.Hide()
+				systray.SetTooltip("Window Tracker")
+			}
+		}
+	}()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"trackerdata"
+)
+
+// errReadingDropped is returned for readings that policy says must not be recorded at all
+var errReadingDropped = errors.New("reading dropped by privacy policy")
+
+// IncognitoPolicy decides what is recorded for tabs the extension flags as incognito/private
+type IncognitoPolicy string
+
+const (
+	IncognitoDrop    IncognitoPolicy = "drop"    // record nothing, not even the time
+	IncognitoDomain  IncognitoPolicy = "domain"  // record only the site's domain
+	IncognitoGeneric IncognitoPolicy = "generic" // record a generic "Private browsing" entry
+)
+
+// privateBrowsingName is the tab name recorded under IncognitoGeneric
+const privateBrowsingName = "Private browsing"
+
+// applyIncognitoPolicy rewrites a private tab according to the configured policy.
+// Returns false if the reading should be dropped.
+func applyIncognitoPolicy(tab TabInfo) (TabInfo, bool) {
+	if !tab.Incognito {
+		return tab, true
+	}
+
+	configMu.Lock()
+	policy := config.IncognitoPolicy
+	configMu.Unlock()
+
+	switch policy {
+	case IncognitoDrop:
+		return TabInfo{}, false
+	case IncognitoDomain:
+		domain := trackerdata.Domain(tab.URL)
+		tab.Title = domain
+		tab.URL = domain
+	default:
+		tab.Title = privateBrowsingName
+		tab.URL = ""
+	}
+	return tab, true
+}
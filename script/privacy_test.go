@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestApplyIncognitoPolicy(t *testing.T) {
+	configMu.Lock()
+	saved := config.IncognitoPolicy
+	configMu.Unlock()
+	t.Cleanup(func() {
+		configMu.Lock()
+		config.IncognitoPolicy = saved
+		configMu.Unlock()
+	})
+
+	private := TabInfo{TabID: 1, Title: "Secret plans", URL: "https://www.example.com/plans?id=7", Incognito: true}
+	public := TabInfo{TabID: 2, Title: "News", URL: "https://news.example.org/today"}
+	tests := []struct {
+		name   string
+		policy IncognitoPolicy
+		tab    TabInfo
+		want   TabInfo
+		keep   bool
+	}{
+		{"drop", IncognitoDrop, private, TabInfo{}, false},
+		{"domain", IncognitoDomain, private, TabInfo{TabID: 1, Title: "example.com", URL: "example.com", Incognito: true}, true},
+		{"generic", IncognitoGeneric, private, TabInfo{TabID: 1, Title: privateBrowsingName, Incognito: true}, true},
+		{"unset is generic", "", private, TabInfo{TabID: 1, Title: privateBrowsingName, Incognito: true}, true},
+		{"not private", IncognitoDrop, public, public, true},
+	}
+	for _, test := range tests {
+		configMu.Lock()
+		config.IncognitoPolicy = test.policy
+		configMu.Unlock()
+		got, keep := applyIncognitoPolicy(test.tab)
+		if got != test.want || keep != test.keep {
+			t.Errorf("%s: got %+v, %v; want %+v, %v", test.name, got, keep, test.want, test.keep)
+		}
+	}
+}
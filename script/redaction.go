@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	// redactor applies the configured redaction rules, built from config in onReady
+	redactor   *Redactor
+	redactorMu sync.Mutex
+
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	numberPattern = regexp.MustCompile(`\d{4,}`)
+)
+
+// Placeholders used by the built-in masks
+const (
+	maskedEmail  = "[email]"
+	maskedNumber = "#"
+)
+
+// RedactionConfig controls how tab titles and URLs are scrubbed before they are written
+type RedactionConfig struct {
+	StripQuery  bool            `json:"strip_query"`  // drop ?query and #fragment from URLs
+	MaskEmails  bool            `json:"mask_emails"`  // replace email addresses with [email]
+	MaskNumbers bool            `json:"mask_numbers"` // replace runs of 4+ digits with #, outside URL hosts and ports
+	Rules       []RedactionRule `json:"rules"`
+}
+
+// RedactionRule replaces every match of a regex in a tab title, URL, or both
+type RedactionRule struct {
+	Name    string `json:"name"`
+	Field   string `json:"field"` // "title", "url", or "" for both
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"` // may reference groups as $1; defaults to [redacted]
+}
+
+// defaultRedaction returns the redaction settings used when collector.json has none
+func defaultRedaction() RedactionConfig {
+	return RedactionConfig{
+		StripQuery: true,
+		MaskEmails: true,
+		Rules:      []RedactionRule{},
+	}
+}
+
+// compiledRule is a RedactionRule with its regex compiled
+type compiledRule struct {
+	RedactionRule
+	re *regexp.Regexp
+}
+
+// Redactor applies a RedactionConfig to titles and URLs
+type Redactor struct {
+	cfg   RedactionConfig
+	rules []compiledRule
+}
+
+// NewRedactor compiles the rules in cfg. Rules that fail to compile are skipped and reported.
+func NewRedactor(cfg RedactionConfig) (*Redactor, []error) {
+	r := &Redactor{cfg: cfg}
+	var errs []error
+	for _, rule := range cfg.Rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("redaction rule %q: %w", rule.Name, err))
+			continue
+		}
+		if rule.Replace == "" {
+			rule.Replace = "[redacted]"
+		}
+		r.rules = append(r.rules, compiledRule{RedactionRule: rule, re: re})
+	}
+	return r, errs
+}
+
+// RedactTitle scrubs a tab title, returning the result and the names of the rules that changed it
+func (r *Redactor) RedactTitle(title string) (string, []string) {
+	return r.apply(title, "title")
+}
+
+// RedactURL scrubs a tab URL, returning the result and the names of the rules that changed it
+func (r *Redactor) RedactURL(rawURL string) (string, []string) {
+	var fired []string
+	if r.cfg.StripQuery {
+		if stripped := stripQuery(rawURL); stripped != rawURL {
+			rawURL = stripped
+			fired = append(fired, "strip_query")
+		}
+	}
+	redacted, more := r.apply(rawURL, "url")
+	return redacted, append(fired, more...)
+}
+
+// apply runs the custom rules for a field, then the built-in masks
+func (r *Redactor) apply(s string, field string) (string, []string) {
+	var fired []string
+	for _, rule := range r.rules {
+		if rule.Field != "" && rule.Field != field {
+			continue
+		}
+		if replaced := rule.re.ReplaceAllString(s, rule.Replace); replaced != s {
+			s = replaced
+			fired = append(fired, rule.Name)
+		}
+	}
+	if r.cfg.MaskEmails {
+		if replaced := emailPattern.ReplaceAllString(s, maskedEmail); replaced != s {
+			s = replaced
+			fired = append(fired, "mask_emails")
+		}
+	}
+	if r.cfg.MaskNumbers {
+		// Ports and hosts aren't personal, so only the path, query and fragment of a URL are masked
+		head, rest := "", s
+		if field == "url" {
+			head, rest = splitURLAuthority(s)
+		}
+		if replaced := numberPattern.ReplaceAllString(rest, maskedNumber); replaced != rest {
+			s = head + replaced
+			fired = append(fired, "mask_numbers")
+		}
+	}
+	return s, fired
+}
+
+// splitURLAuthority splits a URL after its scheme and host (with any user and port), before the path.
+// A string without a scheme is all path.
+func splitURLAuthority(rawURL string) (string, string) {
+	i := strings.Index(rawURL, "://")
+	if i < 0 {
+		return "", rawURL
+	}
+	i += len("://")
+	if end := strings.IndexAny(rawURL[i:], "/?#"); end >= 0 {
+		i += end
+	} else {
+		i = len(rawURL)
+	}
+	return rawURL[:i], rawURL[i:]
+}
+
+// stripQuery removes the query string and fragment from a URL
+func stripQuery(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		// Fall back to cutting at the first ? or # so a malformed URL can't leak its query
+		if i := strings.IndexAny(rawURL, "?#"); i >= 0 {
+			return rawURL[:i]
+		}
+		return rawURL
+	}
+	parsed.RawQuery = ""
+	parsed.ForceQuery = false
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	return parsed.String()
+}
+
+// applyRedaction scrubs the tab title and URL of a reading with the active redactor
+func applyRedaction(reading WindowReading) WindowReading {
+	redactorMu.Lock()
+	r := redactor
+	redactorMu.Unlock()
+	if r == nil {
+		return reading
+	}
+
+	reading.TabName, _ = r.RedactTitle(reading.TabName)
+	reading.TabUrl, _ = r.RedactURL(reading.TabUrl)
+	return reading
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// SessionEvent is a typed marker written into the span stream in place of an app name.
+// Marker rows have start == end and no tab or activity information.
+type SessionEvent string
+
+const (
+	EventOff            SessionEvent = "Off" // clean collector exit (kept from the sample format)
+	EventSuspend        SessionEvent = "@suspend"
+	EventResume         SessionEvent = "@resume"
+	EventLocked         SessionEvent = "@locked"
+	EventUnlocked       SessionEvent = "@unlocked"
+	EventShutdown       SessionEvent = "@shutdown"
+	EventTerminated     SessionEvent = "@sigterm"
+	EventCrashRecovered SessionEvent = "@crash_recovered"
+
+	// Written when the user pauses and resumes tracking from the systray
+	EventTrackingPaused  SessionEvent = "@tracking_paused"
+	EventTrackingResumed SessionEvent = "@tracking_resumed"
+)
+
+// pausesTracking reports whether no time should be credited after this event until a resuming event
+func (ev SessionEvent) pausesTracking() bool {
+	switch ev {
+	case EventOff, EventSuspend, EventLocked, EventShutdown, EventTerminated:
+		return true
+	}
+	return false
+}
+
+// recordSessionEvent closes the open span, writes the marker and pauses or resumes span tracking.
+// A user pause is tracked separately so that unlocking or resuming from sleep doesn't end it.
+func recordSessionEvent(ev SessionEvent, at time.Time) {
+	log.Printf("Session event: %s", ev)
+	switch ev {
+	case EventTrackingPaused:
+		spans.setUserPaused(true, at)
+	case EventTrackingResumed:
+		spans.setUserPaused(false, at)
+	default:
+		spans.setPaused(ev.pausesTracking(), at)
+	}
+	zone, _ := recordingZone()
+	storeSpan(Span{
+		ExePath: string(ev),
+		Start:   at,
+		End:     at,
+		Zone:    zone,
+	})
+	// Sleep, lock and exit may be followed by power loss, so don't leave the marker in memory
+	syncStorage()
+	writeHeartbeat()
+}
+
+// startSessionMonitor records SIGTERM/SIGINT and the platform's sleep and lock notifications
+func startSessionMonitor() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-signals
+		recordSessionEvent(EventTerminated, time.Now())
+		systray.Quit()
+	}()
+
+	go func() {
+		if err := watchSessionEvents(recordSessionEvent); err != nil {
+			log.Printf("Session notifications unavailable: %v", err)
+		}
+	}()
+}
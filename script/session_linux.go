@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// watchSessionEvents listens for logind sleep/shutdown signals on the system bus and screensaver
+// activation on the session bus, and blocks while forwarding them to record
+func watchSessionEvents(record func(SessionEvent, time.Time)) error {
+	system, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("connect to system bus: %w", err)
+	}
+	if err := system.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.login1.Manager"),
+		dbus.WithMatchObjectPath("/org/freedesktop/login1"),
+	); err != nil {
+		return err
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	system.Signal(signals)
+
+	// GNOME only emits ActiveChanged on its own interface, so both are watched
+	if session, err := dbus.SessionBus(); err == nil {
+		for _, iface := range []string{"org.freedesktop.ScreenSaver", "org.gnome.ScreenSaver"} {
+			session.AddMatchSignal(dbus.WithMatchInterface(iface), dbus.WithMatchMember("ActiveChanged"))
+		}
+		session.Signal(signals)
+	}
+
+	for signal := range signals {
+		if len(signal.Body) == 0 {
+			continue
+		}
+		active, ok := signal.Body[0].(bool)
+		if !ok {
+			continue
+		}
+
+		switch signal.Name {
+		case "org.freedesktop.login1.Manager.PrepareForSleep":
+			if active {
+				record(EventSuspend, time.Now())
+			} else {
+				record(EventResume, time.Now())
+			}
+		case "org.freedesktop.login1.Manager.PrepareForShutdown":
+			if active {
+				record(EventShutdown, time.Now())
+			}
+		case "org.freedesktop.ScreenSaver.ActiveChanged", "org.gnome.ScreenSaver.ActiveChanged":
+			if active {
+				record(EventLocked, time.Now())
+			} else {
+				record(EventUnlocked, time.Now())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// watchSessionEvents reports that this platform has no sleep or lock notifications yet
+func watchSessionEvents(record func(SessionEvent, time.Time)) error {
+	return fmt.Errorf("no session notifications on %s", runtime.GOOS)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32                             = windows.NewLazySystemDLL("user32.dll")
+	procRegisterClassExW               = user32.NewProc("RegisterClassExW")
+	procCreateWindowExW                = user32.NewProc("CreateWindowExW")
+	procDefWindowProcW                 = user32.NewProc("DefWindowProcW")
+	procGetMessageW                    = user32.NewProc("GetMessageW")
+	procTranslateMessage               = user32.NewProc("TranslateMessage")
+	procDispatchMessageW               = user32.NewProc("DispatchMessageW")
+	procWTSRegisterSessionNotification = windows.NewLazySystemDLL("wtsapi32.dll").NewProc("WTSRegisterSessionNotification")
+)
+
+const (
+	wmEndSession         = 0x0016
+	wmPowerBroadcast     = 0x0218
+	wmWTSSessionChange   = 0x02B1
+	pbtAPMSuspend        = 0x0004
+	pbtAPMResumeAuto     = 0x0012
+	wtsSessionLock       = 0x7
+	wtsSessionUnlock     = 0x8
+	notifyForThisSession = 0
+)
+
+// wndClassEx mirrors the Win32 WNDCLASSEXW struct
+type wndClassEx struct {
+	cbSize        uint32
+	style         uint32
+	lpfnWndProc   uintptr
+	cbClsExtra    int32
+	cbWndExtra    int32
+	hInstance     windows.Handle
+	hIcon         windows.Handle
+	hCursor       windows.Handle
+	hbrBackground windows.Handle
+	lpszMenuName  *uint16
+	lpszClassName *uint16
+	hIconSm       windows.Handle
+}
+
+// msg mirrors the Win32 MSG struct
+type msg struct {
+	hwnd    windows.HWND
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      struct{ x, y int32 }
+}
+
+// watchSessionEvents creates a hidden window to receive power and session-change broadcasts,
+// and blocks in its message loop forwarding them to record
+func watchSessionEvents(record func(SessionEvent, time.Time)) error {
+	// Window messages are delivered to the thread that created the window
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	wndProc := func(hwnd windows.HWND, message uint32, wParam, lParam uintptr) uintptr {
+		switch message {
+		case wmPowerBroadcast:
+			switch wParam {
+			case pbtAPMSuspend:
+				record(EventSuspend, time.Now())
+			case pbtAPMResumeAuto:
+				// Sent on every resume, unlike PBT_APMRESUMESUSPEND which follows it when the user is
+				// present, so only this one is recorded to avoid a second @resume
+				record(EventResume, time.Now())
+			}
+		case wmWTSSessionChange:
+			switch wParam {
+			case wtsSessionLock:
+				record(EventLocked, time.Now())
+			case wtsSessionUnlock:
+				record(EventUnlocked, time.Now())
+			}
+		case wmEndSession:
+			if wParam != 0 {
+				record(EventShutdown, time.Now())
+			}
+		}
+		ret, _, _ := procDefWindowProcW.Call(uintptr(hwnd), uintptr(message), wParam, lParam)
+		return ret
+	}
+
+	className, _ := windows.UTF16PtrFromString("TrackerSessionWatcher")
+	class := wndClassEx{
+		lpfnWndProc:   windows.NewCallback(wndProc),
+		lpszClassName: className,
+	}
+	class.cbSize = uint32(unsafe.Sizeof(class))
+	if atom, _, err := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&class))); atom == 0 {
+		return fmt.Errorf("register window class: %w", err)
+	}
+
+	// A hidden top-level window rather than a message-only one, since those don't get broadcasts
+	hwnd, _, err := procCreateWindowExW.Call(0, uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(className)),
+		0, 0, 0, 0, 0, 0, 0, 0, 0)
+	if hwnd == 0 {
+		return fmt.Errorf("create window: %w", err)
+	}
+
+	if ok, _, err := procWTSRegisterSessionNotification.Call(hwnd, notifyForThisSession); ok == 0 {
+		return fmt.Errorf("register session notification: %w", err)
+	}
+
+	var m msg
+	for {
+		ret, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+		if int32(ret) <= 0 {
+			return nil
+		}
+		procTranslateMessage.Call(uintptr(unsafe.Pointer(&m)))
+		procDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"sync"
+	"time"
+	"trackerdata"
+)
+
+var (
+	// spans turns the stream of readings into spans and writes them out
+	spans spanTracker
+
+	// stateChanged wakes the tracking loop early when something other than polling changes state
+	stateChanged = make(chan struct{}, 1)
+)
+
+// Span is a continuous period with the same focused window, tab and activity state.
+// Open spans are rewritten as checkpoints with the same Start; the row with the latest End wins.
+type Span struct {
+	ExePath     string       `json:"exePath"`
+	TabName     string       `json:"tabName"`
+	TabUrl      string       `json:"tabUrl"`
+	Start       time.Time    `json:"start"`
+	End         time.Time    `json:"end"`
+	HadActivity bool         `json:"hadActivity"`
+	Audible     bool         `json:"audible"`         // sound was playing, so idle time is passive rather than absent
+	Input       *InputCounts `json:"input,omitempty"` // keystrokes, clicks and scrolls during the span, nil if not counted
+	Zone        string       `json:"zone,omitempty"`  // time zone the span was recorded in, see recordingZone
+}
+
+// record converts the span to its row in the span file
+func (s Span) record() trackerdata.Span {
+	return trackerdata.Span{
+		Name:        s.ExePath,
+		Start:       s.Start,
+		End:         s.End,
+		TabName:     s.TabName,
+		TabUrl:      s.TabUrl,
+		HadActivity: s.HadActivity,
+		Audible:     s.Audible,
+		Input:       s.Input,
+		Zone:        s.Zone,
+	}
+}
+
+// sameWindow checks whether a reading shows the same window and tab as the span
+func (s *Span) sameWindow(r WindowReading) bool {
+	return s.ExePath == r.ExePath && s.TabName == r.TabName && s.TabUrl == r.TabUrl
+}
+
+// spanTracker holds the currently open span
+type spanTracker struct {
+	mu         sync.Mutex
+	current    *Span
+	lastWrite  time.Time
+	paused     bool // set while suspended, locked or shutting down
+	userPaused bool // set while the user has paused tracking from the systray
+}
+
+// notifyStateChanged asks the tracking loop to take a reading now instead of at the next tick
+func notifyStateChanged() {
+	select {
+	case stateChanged <- struct{}{}:
+	default:
+	}
+}
+
+// observe extends the open span with a reading, or closes it and opens a new one if the state changed
+func (t *spanTracker) observe(r WindowReading) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.paused || t.userPaused {
+		return
+	}
+
+	if t.current != nil && r.Timestamp.Sub(t.current.End) > maxPollGap {
+		// No samples for a while; sleep should have been reported as an event, but platforms
+		// without notifications still need the span ended where we last saw it
+		t.closeLocked(t.current.End)
+	}
+
+	if t.current != nil && t.current.sameWindow(r) && t.current.HadActivity == r.HadActivity && t.current.Audible == r.Audible {
+		t.current.End = r.Timestamp
+		t.current.Input = addInput(t.current.Input, r.Input)
+		if r.Timestamp.Sub(t.lastWrite) >= checkpointInterval {
+			storeSpan(*t.current)
+			t.lastWrite = r.Timestamp
+		}
+		return
+	}
+
+	// Going idle is only noticed inactiveThreshold after the last input; backdate the switch so
+	// the idle tail isn't credited as active time
+	start := r.Timestamp
+	if t.current != nil && t.current.HadActivity && !r.HadActivity && t.current.sameWindow(r) && r.LastInput.After(t.current.Start) {
+		start = r.LastInput
+	}
+	t.closeLocked(start)
+
+	zone, _ := recordingZone()
+	t.current = &Span{
+		ExePath:     r.ExePath,
+		TabName:     r.TabName,
+		TabUrl:      r.TabUrl,
+		Start:       start,
+		End:         r.Timestamp,
+		HadActivity: r.HadActivity,
+		Audible:     r.Audible,
+		Input:       r.Input,
+		Zone:        zone,
+	}
+	t.lastWrite = r.Timestamp
+}
+
+// snapshot returns a copy of the open span, or nil if none is open
+func (t *spanTracker) snapshot() *Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil {
+		return nil
+	}
+	span := *t.current
+	return &span
+}
+
+// interrupt ends the open span at the given time without pausing tracking
+func (t *spanTracker) interrupt(at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closeLocked(at)
+}
+
+// setPaused ends the open span at the given time and stops or restarts span tracking
+func (t *spanTracker) setPaused(paused bool, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closeLocked(at)
+	t.paused = paused
+}
+
+// setUserPaused ends the open span at the given time and stops or restarts tracking on the user's behalf
+func (t *spanTracker) setUserPaused(paused bool, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closeLocked(at)
+	t.userPaused = paused
+}
+
+func (t *spanTracker) closeLocked(at time.Time) {
+	if t.current == nil {
+		return
+	}
+	if at.After(t.current.Start) {
+		t.current.End = at
+	}
+	// Zero-length spans carry no time, so they are never written
+	if t.current.End.After(t.current.Start) {
+		storeSpan(*t.current)
+	}
+	t.current = nil
+}
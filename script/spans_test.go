@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// poll is one tick of the tracking loop in a test: the fake source reports its next window, or err
+type poll struct {
+	at        int // seconds since the start of the test
+	err       error
+	active    bool
+	lastInput int // seconds since the start of the test
+}
+
+// polls returns a poll for every second in [from, to]
+func polls(from, to int, active bool, lastInput int) []poll {
+	list := []poll{}
+	for at := from; at <= to; at++ {
+		list = append(list, poll{at: at, active: active, lastInput: lastInput})
+	}
+	return list
+}
+
+// failing returns a failed poll for every second in [from, to]
+func failing(from, to int, err error) []poll {
+	list := []poll{}
+	for at := from; at <= to; at++ {
+		list = append(list, poll{at: at, err: err})
+	}
+	return list
+}
+
+// wantSpan is a span expected in the storage queue, with times in seconds since the start of the test
+type wantSpan struct {
+	exe        string
+	start, end int
+	active     bool
+}
+
+func TestSpanTrackerWithFakeSource(t *testing.T) {
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	a := FocusedWindow{ExePath: `C:\Program Files\Editor\editor.exe`, Title: "notes.txt"}
+	b := FocusedWindow{ExePath: "/usr/bin/terminal", Title: "shell"}
+
+	tests := []struct {
+		name    string
+		windows []FocusedWindow // reported in order by the polls that don't fail
+		polls   [][]poll
+		end     int // the open span is ended here
+		want    []wantSpan
+	}{
+		{
+			name:    "window switch",
+			windows: []FocusedWindow{a, a, a, a, b, b, b},
+			polls:   [][]poll{polls(0, 6, true, 0)},
+			end:     6,
+			want:    []wantSpan{{"editor.exe", 0, 4, true}, {"terminal", 4, 6, true}},
+		},
+		{
+			name:    "going idle is backdated to the last input",
+			windows: []FocusedWindow{a},
+			polls:   [][]poll{polls(0, 10, true, 10), polls(11, 130, true, 10), polls(131, 140, false, 10)},
+			end:     140,
+			want:    []wantSpan{{"editor.exe", 0, 10, true}, {"editor.exe", 10, 140, false}},
+		},
+		{
+			name:    "short errors leave the span open",
+			windows: []FocusedWindow{a},
+			polls:   [][]poll{polls(0, 3, true, 0), failing(4, 5, errNoFocusedWindow), polls(6, 8, true, 0)},
+			end:     8,
+			want:    []wantSpan{{"editor.exe", 0, 8, true}},
+		},
+		{
+			name:    "long errors end the span where it was last seen",
+			windows: []FocusedWindow{a, a, a, a, b},
+			polls:   [][]poll{polls(0, 3, true, 0), failing(4, 30, errors.New("display closed")), polls(31, 31, true, 0)},
+			end:     31,
+			want:    []wantSpan{{"editor.exe", 0, 3, true}},
+		},
+		{
+			name:    "dropped readings interrupt the span",
+			windows: []FocusedWindow{a},
+			polls:   [][]poll{polls(0, 3, true, 0), failing(4, 4, errReadingDropped), polls(5, 7, true, 0)},
+			end:     7,
+			want:    []wantSpan{{"editor.exe", 0, 4, true}, {"editor.exe", 5, 7, true}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage.mu.Lock()
+			storage.pending = nil
+			storage.mu.Unlock()
+
+			source := newFakeSource(test.windows...)
+			var tracker spanTracker
+			at := func(seconds int) time.Time { return base.Add(time.Duration(seconds) * time.Second) }
+
+			// Handle readings as trackingLoop does
+			for _, group := range test.polls {
+				for _, p := range group {
+					source.SetError(p.err)
+					window, err := source.FocusedWindow()
+					if errors.Is(err, errReadingDropped) {
+						tracker.interrupt(at(p.at))
+						continue
+					}
+					if err != nil {
+						continue
+					}
+					tracker.observe(WindowReading{
+						ExePath:     exeBaseName(window.ExePath),
+						Timestamp:   at(p.at),
+						HadActivity: p.active,
+						LastInput:   at(p.lastInput),
+					})
+				}
+			}
+			tracker.interrupt(at(test.end))
+
+			storage.mu.Lock()
+			queued := storage.pending
+			storage.pending = nil
+			storage.mu.Unlock()
+
+			// An open span is checkpointed with the same start; the last row written is the one that counts
+			got := []Span{}
+			for _, span := range queued {
+				if n := len(got) - 1; n >= 0 && got[n].ExePath == span.ExePath && got[n].Start.Equal(span.Start) {
+					got[n] = span
+				} else {
+					got = append(got, span)
+				}
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d spans %+v, want %d", len(got), got, len(test.want))
+			}
+			for i, want := range test.want {
+				span := got[i]
+				if span.ExePath != want.exe || !span.Start.Equal(at(want.start)) || !span.End.Equal(at(want.end)) || span.HadActivity != want.active {
+					t.Errorf("span %d = %s %s-%s active=%v, want %s %s-%s active=%v", i,
+						span.ExePath, span.Start.Format(time.TimeOnly), span.End.Format(time.TimeOnly), span.HadActivity,
+						want.exe, at(want.start).Format(time.TimeOnly), at(want.end).Format(time.TimeOnly), want.active)
+				}
+			}
+		})
+	}
+}
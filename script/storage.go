@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"trackerdata"
+
+	"github.com/getlantern/systray"
+)
+
+// maxPendingSpans bounds the queue while the disk can't be written; the oldest spans are dropped beyond it
+const maxPendingSpans = 10000
+
+// storage queues spans and writes them to the configured store in the background
+var storage spanStore
+
+// StorageConfig sets where spans are written and how often queued spans are written out and committed to disk
+type StorageConfig struct {
+	Backend      string `json:"backend"`                // csv (default), jsonl or sqlite
+	FlushSeconds int    `json:"flush_interval_seconds"` // how often queued spans are written to the day file
+	SyncSeconds  int    `json:"sync_interval_seconds"`  // how often the day file is fsynced
+}
+
+// defaultStorage returns the storage settings used when collector.json has none
+func defaultStorage() StorageConfig {
+	return StorageConfig{Backend: trackerdata.BackendCSV, FlushSeconds: 5, SyncSeconds: 60}
+}
+
+// spanStore keeps a trackerdata.Store open and writes queued spans to it in batches.
+// Spans stay queued until they are written, so a failed write is retried on the next flush.
+// Queueing takes only mu, which is never held while writing, so a slow disk doesn't hold up the span tracker.
+type spanStore struct {
+	mu      sync.Mutex
+	pending []Span
+	err     error // last write error, cleared by the next successful flush
+	dropped int   // spans dropped because the queue was full
+
+	writeMu sync.Mutex // held while the store is opened, written, synced or closed
+	backend string
+	store   trackerdata.Store // opened on the first flush
+	day     string            // date in the recording zone when the store was opened
+	dirty   bool              // written since the last fsync
+
+	openStore func() (trackerdata.Store, error) // opens the store; the backend in the data folder if nil
+	today     func() string                     // the date in the recording zone; today() if nil
+}
+
+// storeSpan queues a span, or a checkpoint of a span that is still open, for the file of the day it started on
+func storeSpan(span Span) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	storage.queueLocked([]Span{span}, false)
+}
+
+// queueLocked adds spans to the queue, at the front if they are being put back after a failed write,
+// dropping the oldest beyond maxPendingSpans
+func (s *spanStore) queueLocked(spans []Span, front bool) {
+	if front {
+		s.pending = append(spans, s.pending...)
+	} else {
+		s.pending = append(s.pending, spans...)
+	}
+	if over := len(s.pending) - maxPendingSpans; over > 0 {
+		s.pending = s.pending[over:]
+		s.dropped += over
+	}
+}
+
+// flush writes the queued spans, and fsyncs them if sync is set.
+// On failure the store is closed so the next flush starts again from a fresh open.
+func (s *spanStore) flush(sync bool) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if err := s.writeLocked(batch); err != nil {
+		s.mu.Lock()
+		s.queueLocked(batch, true)
+		s.mu.Unlock()
+		return s.failLocked(err)
+	}
+	if sync && s.dirty {
+		if err := s.store.Sync(); err != nil {
+			return s.failLocked(err)
+		}
+		s.dirty = false
+	}
+
+	// Rotate at local midnight: nothing more is expected for an earlier day, so let its file go
+	if s.store != nil && s.day != s.currentDay() {
+		if err := s.closeLocked(); err != nil {
+			return s.failLocked(err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		log.Printf("Storage recovered, all spans written")
+		s.err = nil
+	}
+	return nil
+}
+
+// setBackend chooses where spans are written; it must be called before anything is flushed
+func (s *spanStore) setBackend(backend string) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	switch backend {
+	case "", trackerdata.BackendCSV, trackerdata.BackendJSONL, trackerdata.BackendSQLite:
+	default:
+		log.Printf("Unknown storage backend %q, writing csv", backend)
+		backend = trackerdata.BackendCSV
+	}
+	s.backend = backend
+}
+
+// open opens another store on the data folder with the same backend, for maintenance
+func (s *spanStore) open() (trackerdata.Store, error) {
+	s.writeMu.Lock()
+	backend := s.backend
+	s.writeMu.Unlock()
+	return trackerdata.OpenStore(backend, trackerdata.Dir())
+}
+
+// writeLocked writes a batch of spans, opening the store if needed
+func (s *spanStore) writeLocked(batch []Span) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if s.store == nil {
+		open := s.openStore
+		if open == nil {
+			open = func() (trackerdata.Store, error) { return trackerdata.OpenStore(s.backend, trackerdata.Dir()) }
+		}
+		store, err := open()
+		if err != nil {
+			return err
+		}
+		s.store = store
+		s.day = s.currentDay()
+	}
+
+	records := make([]trackerdata.Span, len(batch))
+	for i, span := range batch {
+		records[i] = span.record()
+	}
+	if err := s.store.Append(records); err != nil {
+		return err
+	}
+	s.dirty = true
+	return nil
+}
+
+// currentDay returns the date in the recording zone
+func (s *spanStore) currentDay() string {
+	if s.today != nil {
+		return s.today()
+	}
+	return today()
+}
+
+// closeLocked fsyncs and closes the store, if it is open
+func (s *spanStore) closeLocked() error {
+	if s.store == nil {
+		return nil
+	}
+	store := s.store
+	s.store = nil
+	s.dirty = false
+	return store.Close()
+}
+
+// failLocked records a write error and drops the store so it is reopened on the next attempt
+func (s *spanStore) failLocked(err error) error {
+	if s.store != nil {
+		s.store.Close()
+		s.store = nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil || s.err.Error() != err.Error() {
+		log.Printf("Storage error, %d spans waiting: %v", len(s.pending), err)
+	}
+	s.err = err
+	return err
+}
+
+// status describes a storage problem for the systray, or returns "" if spans are being written
+func (s *spanStore) status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.err != nil:
+		return fmt.Sprintf("Can't save data (%d spans waiting): %v", len(s.pending), s.err)
+	case s.dropped > 0:
+		return fmt.Sprintf("%d spans were lost while data couldn't be saved", s.dropped)
+	}
+	return ""
+}
+
+// runStorage writes queued spans every flush interval and fsyncs every sync interval
+func runStorage(cfg StorageConfig) {
+	flushInterval := time.Duration(cfg.FlushSeconds) * time.Second
+	syncInterval := time.Duration(cfg.SyncSeconds) * time.Second
+	if flushInterval <= 0 {
+		flushInterval = time.Duration(defaultStorage().FlushSeconds) * time.Second
+	}
+	if syncInterval < flushInterval {
+		syncInterval = flushInterval
+	}
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	lastSync := time.Now()
+	for range ticker.C {
+		sync := time.Since(lastSync) >= syncInterval
+		if err := storage.flush(sync); err == nil && sync {
+			lastSync = time.Now()
+		}
+	}
+}
+
+// syncStorage writes and fsyncs everything queued so far, e.g. before the machine sleeps
+func syncStorage() error {
+	return storage.flush(true)
+}
+
+// closeStorage writes everything queued and closes the store, retrying briefly if the disk is busy
+func closeStorage() {
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(500 * time.Millisecond)
+		}
+		if err := storage.flush(true); err != nil {
+			continue
+		}
+		storage.writeMu.Lock()
+		err := storage.closeLocked()
+		storage.writeMu.Unlock()
+		if err == nil {
+			return
+		}
+		log.Printf("Storage error on exit: %v", err)
+	}
+	log.Printf("Exiting with unsaved spans: %s", storage.status())
+}
+
+// runStorageStatusMenu shows the status menu item while spans can't be written
+func runStorageStatusMenu(item *systray.MenuItem) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		status := storage.status()
+		if status != last {
+			if status == "" {
+				item.Hide()
+			} else {
+				item.SetTitle(status)
+				item.Show()
+			}
+			last = status
+		}
+		<-ticker.C
+	}
+}
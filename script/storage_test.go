@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"trackerdata"
+)
+
+// failingStore is an in-memory store whose writes fail while err is set
+type failingStore struct {
+	*trackerdata.MemoryStore
+	err    error
+	opens  int
+	closes int
+}
+
+func (f *failingStore) Append(spans []trackerdata.Span) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.MemoryStore.Append(spans)
+}
+
+func (f *failingStore) Sync() error {
+	return f.err
+}
+
+func (f *failingStore) Close() error {
+	f.closes++
+	return nil
+}
+
+// testStorage returns a spanStore writing to store, on the date held by day
+func testStorage(store *failingStore, day *string) *spanStore {
+	return &spanStore{
+		openStore: func() (trackerdata.Store, error) {
+			store.opens++
+			return store, nil
+		},
+		today: func() string { return *day },
+	}
+}
+
+// queue adds spans to a spanStore's queue as storeSpan does
+func (s *spanStore) queue(spans ...Span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queueLocked(spans, false)
+}
+
+// storedNames returns the names of the spans in a store, in order
+func storedNames(t *testing.T, store trackerdata.Store) []string {
+	t.Helper()
+	names := []string{}
+	if err := store.Spans(time.Time{}, time.Time{}, func(span trackerdata.Span) error {
+		names = append(names, span.Name)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+// testStorageSpan returns a one-minute span starting the given number of minutes after 9:00 on March 1st
+func testStorageSpan(name string, minute int) Span {
+	start := time.Date(2024, 3, 1, 9, minute, 0, 0, time.UTC)
+	return Span{ExePath: name, Start: start, End: start.Add(time.Minute), HadActivity: true, Zone: "UTC"}
+}
+
+func TestSpanStoreRetriesFailedWrites(t *testing.T) {
+	day := "20240301"
+	store := &failingStore{MemoryStore: trackerdata.NewMemoryStore(), err: errors.New("disk full")}
+	s := testStorage(store, &day)
+
+	s.queue(testStorageSpan("a", 0), testStorageSpan("b", 1))
+	if err := s.flush(true); err == nil {
+		t.Fatal("flush succeeded on a failing store")
+	}
+	s.queue(testStorageSpan("c", 2))
+	if err := s.flush(false); err == nil {
+		t.Fatal("flush succeeded on a failing store")
+	}
+	if status := s.status(); !strings.Contains(status, "3 spans waiting") || !strings.Contains(status, "disk full") {
+		t.Errorf("status %q doesn't report the 3 waiting spans and the error", status)
+	}
+	if store.closes != 2 {
+		t.Errorf("store closed %d times after 2 failures, want 2", store.closes)
+	}
+
+	// Once the disk works again everything is written in order, and the error clears
+	store.err = nil
+	if err := s.flush(true); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(storedNames(t, store), ","); got != "a,b,c" {
+		t.Errorf("stored %s, want a,b,c", got)
+	}
+	if status := s.status(); status != "" {
+		t.Errorf("status %q after recovering, want none", status)
+	}
+	if len(s.pending) != 0 {
+		t.Errorf("%d spans still queued", len(s.pending))
+	}
+}
+
+func TestSpanStoreDropsOldest(t *testing.T) {
+	day := "20240301"
+	store := &failingStore{MemoryStore: trackerdata.NewMemoryStore(), err: errors.New("disk full")}
+	s := testStorage(store, &day)
+
+	for i := 0; i < maxPendingSpans; i++ {
+		s.queue(testStorageSpan("old", 0))
+	}
+	s.flush(false) // fails, putting the batch back in front of what is queued meanwhile
+	s.queue(testStorageSpan("new", 1), testStorageSpan("newer", 2))
+
+	if len(s.pending) != maxPendingSpans {
+		t.Fatalf("%d spans queued, want %d", len(s.pending), maxPendingSpans)
+	}
+	if last := s.pending[len(s.pending)-1].ExePath; last != "newer" {
+		t.Errorf("last queued span is %s, want newer", last)
+	}
+	if status := s.status(); !strings.Contains(status, "Can't save data") {
+		t.Errorf("status %q doesn't report the error", status)
+	}
+
+	store.err = nil
+	if err := s.flush(false); err != nil {
+		t.Fatal(err)
+	}
+	if status := s.status(); status != "2 spans were lost while data couldn't be saved" {
+		t.Errorf("status %q, want the 2 lost spans", status)
+	}
+}
+
+func TestSpanStoreRotatesAtMidnight(t *testing.T) {
+	day := "20240301"
+	store := &failingStore{MemoryStore: trackerdata.NewMemoryStore()}
+	s := testStorage(store, &day)
+
+	s.queue(testStorageSpan("a", 0))
+	if err := s.flush(false); err != nil {
+		t.Fatal(err)
+	}
+	s.queue(testStorageSpan("b", 1))
+	if err := s.flush(true); err != nil {
+		t.Fatal(err)
+	}
+	if store.opens != 1 || store.closes != 0 {
+		t.Fatalf("opened %d and closed %d times during the day, want 1 and 0", store.opens, store.closes)
+	}
+
+	// The first flush after midnight lets the day's store go, even with nothing to write
+	day = "20240302"
+	if err := s.flush(false); err != nil {
+		t.Fatal(err)
+	}
+	if store.closes != 1 || s.store != nil {
+		t.Fatalf("store still open after midnight (closed %d times)", store.closes)
+	}
+
+	// The next write opens it again for the new day
+	s.queue(testStorageSpan("c", 2))
+	if err := s.flush(false); err != nil {
+		t.Fatal(err)
+	}
+	if store.opens != 2 || s.day != "20240302" {
+		t.Errorf("opened %d times, on %s; want 2, on 20240302", store.opens, s.day)
+	}
+	if got := strings.Join(storedNames(t, store), ","); got != "a,b,c" {
+		t.Errorf("stored %s, want a,b,c", got)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// windowSourceEnv overrides automatic backend detection (e.g. "x11" or "fake")
+const windowSourceEnv = "TRACKER_WINDOW_SOURCE"
+
+// windowSource is the platform backend used by getFocusedWindowInfo, chosen in onReady
+var windowSource WindowSource
+
+// errNoFocusedWindow is returned when no window currently has focus (e.g. the desktop is focused)
+var errNoFocusedWindow = errors.New("no focused window")
+
+// FocusedWindow describes the window that currently has input focus
+type FocusedWindow struct {
+	ExePath string // full path to the executable that owns the window
+	Title   string // window title, if the backend can provide it
+}
+
+// WindowSource reports the currently focused window on a given platform or desktop
+type WindowSource interface {
+	FocusedWindow() (FocusedWindow, error)
+}
+
+// DBusWindowProvider names a D-Bus service that lists windows as JSON through List and GetTitle methods,
+// as the GNOME Shell "Window Calls" extension does. It is set by dbus_window_provider in collector.json.
+type DBusWindowProvider struct {
+	Destination string `json:"destination"`
+	Path        string `json:"path"`
+	Interface   string `json:"interface"`
+}
+
+// defaultDBusWindowProvider returns the GNOME Shell "Window Calls" extension
+func defaultDBusWindowProvider() DBusWindowProvider {
+	return DBusWindowProvider{
+		Destination: "org.gnome.Shell",
+		Path:        "/org/gnome/Shell/Extensions/Windows",
+		Interface:   "org.gnome.Shell.Extensions.Windows",
+	}
+}
+
+// openWindowSource returns the backend named by TRACKER_WINDOW_SOURCE, or the platform default.
+// The "fake" backend reports a single placeholder window and is available on every platform.
+func openWindowSource() (WindowSource, error) {
+	name := os.Getenv(windowSourceEnv)
+	if name == "fake" {
+		return newFakeSource(FocusedWindow{ExePath: "fake", Title: "Fake window"}), nil
+	}
+	return newWindowSource(name)
+}
+
+// exeBaseName returns the file name portion of an exe path using either path separator,
+// so Windows paths are handled the same regardless of the platform the collector runs on
+func exeBaseName(exePath string) string {
+	if i := strings.LastIndexAny(exePath, `\/`); i >= 0 {
+		return exePath[i+1:]
+	}
+	return exePath
+}
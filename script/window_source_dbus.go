@@ -0,0 +1,89 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// dbusWindow is one entry of the provider's List reply
+type dbusWindow struct {
+	ID    uint64 `json:"id"`
+	PID   int    `json:"pid"`
+	Focus bool   `json:"focus"`
+	Title string `json:"title"`
+}
+
+// dbusSource asks a focused-window provider on the session bus which window has focus
+type dbusSource struct {
+	conn     *dbus.Conn
+	provider DBusWindowProvider
+}
+
+// newDBusSource connects to the session bus and checks that the provider answers
+func newDBusSource(provider DBusWindowProvider) (*dbusSource, error) {
+	if provider.Destination == "" || !dbus.ObjectPath(provider.Path).IsValid() || provider.Interface == "" {
+		return nil, fmt.Errorf("incomplete D-Bus window provider %+v", provider)
+	}
+
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("connect to session bus: %w", err)
+	}
+
+	var hasOwner bool
+	err = conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, provider.Destination).Store(&hasOwner)
+	if err != nil {
+		return nil, err
+	}
+	if !hasOwner {
+		return nil, fmt.Errorf("D-Bus window provider %s is not running", provider.Destination)
+	}
+
+	return &dbusSource{conn: conn, provider: provider}, nil
+}
+
+// FocusedWindow returns the exe and title of the window the provider reports as focused
+func (s *dbusSource) FocusedWindow() (FocusedWindow, error) {
+	obj := s.conn.Object(s.provider.Destination, dbus.ObjectPath(s.provider.Path))
+
+	var listJSON string
+	if err := obj.Call(s.provider.Interface+".List", 0).Store(&listJSON); err != nil {
+		return FocusedWindow{}, err
+	}
+
+	var windows []dbusWindow
+	if err := json.Unmarshal([]byte(listJSON), &windows); err != nil {
+		return FocusedWindow{}, fmt.Errorf("decode window list: %w", err)
+	}
+
+	for _, window := range windows {
+		if !window.Focus {
+			continue
+		}
+		if window.PID == 0 {
+			return FocusedWindow{}, errNoFocusedWindow
+		}
+
+		exePath, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", window.PID))
+		if err != nil {
+			return FocusedWindow{}, err
+		}
+
+		// Newer provider versions leave titles out of List and expose them through GetTitle
+		title := window.Title
+		if title == "" {
+			obj.Call(s.provider.Interface+".GetTitle", 0, uint32(window.ID)).Store(&title)
+		}
+
+		return FocusedWindow{
+			ExePath: exePath,
+			Title:   title,
+		}, nil
+	}
+	return FocusedWindow{}, errNoFocusedWindow
+}
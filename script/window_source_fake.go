@@ -0,0 +1,49 @@
+package main
+
+import "sync"
+
+// fakeSource is a scripted WindowSource for tests and for running the collector without a desktop.
+// Each call to FocusedWindow returns the next queued window, repeating the last one once the queue is drained.
+type fakeSource struct {
+	mu      sync.Mutex
+	windows []FocusedWindow
+	err     error
+}
+
+// newFakeSource returns a fakeSource that reports the given windows in order
+func newFakeSource(windows ...FocusedWindow) *fakeSource {
+	return &fakeSource{windows: windows}
+}
+
+// Push queues another window to be reported
+func (f *fakeSource) Push(window FocusedWindow) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.windows = append(f.windows, window)
+}
+
+// SetError makes every subsequent call fail with err (nil clears it)
+func (f *fakeSource) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// FocusedWindow returns the next queued window
+func (f *fakeSource) FocusedWindow() (FocusedWindow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return FocusedWindow{}, f.err
+	}
+	if len(f.windows) == 0 {
+		return FocusedWindow{}, errNoFocusedWindow
+	}
+
+	window := f.windows[0]
+	if len(f.windows) > 1 {
+		f.windows = f.windows[1:]
+	}
+	return window, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// newWindowSource returns the requested Linux backend. Without an explicit choice, Wayland sessions
+// use the sway IPC socket when one is advertised, a KWin script on KDE Plasma, and the configured
+// D-Bus provider otherwise; X11 sessions use EWMH.
+func newWindowSource(name string) (WindowSource, error) {
+	switch name {
+	case "x11":
+		return newX11Source()
+	case "sway":
+		return newSwaySource(swaySocketPath())
+	case "kwin":
+		return newKWinSource()
+	case "dbus":
+		return newDBusSource(configuredWindowProvider())
+	case "":
+		if os.Getenv("WAYLAND_DISPLAY") == "" {
+			return newX11Source()
+		}
+		if socketPath := swaySocketPath(); socketPath != "" {
+			return newSwaySource(socketPath)
+		}
+		if isKDESession() {
+			return newKWinSource()
+		}
+		return newDBusSource(configuredWindowProvider())
+	default:
+		return nil, fmt.Errorf("unknown window source %q", name)
+	}
+}
+
+// configuredWindowProvider returns the D-Bus provider set in collector.json
+func configuredWindowProvider() DBusWindowProvider {
+	configMu.Lock()
+	defer configMu.Unlock()
+	return config.WindowProvider
+}
+
+// isKDESession reports whether the desktop is KDE Plasma
+func isKDESession() bool {
+	for _, desktop := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if strings.EqualFold(desktop, "KDE") {
+			return true
+		}
+	}
+	return false
+}
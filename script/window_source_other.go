@@ -0,0 +1,13 @@
+//go:build !windows && !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newWindowSource reports that this platform has no native backend yet
+func newWindowSource(name string) (WindowSource, error) {
+	return nil, fmt.Errorf("no window source available on %s", runtime.GOOS)
+}
@@ -0,0 +1,180 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/jezek/xgb/xproto"
+)
+
+const (
+	swayIPCMagic   = "i3-ipc"
+	swayIPCGetTree = 4
+)
+
+// swaySource reads the focused window from the sway/i3 IPC socket.
+// A GET_TREE request is issued for every reading and the focused leaf node is resolved through its pid.
+// i3 gives no pid, only the X11 window, which is resolved through _NET_WM_PID instead.
+type swaySource struct {
+	mu         sync.Mutex
+	socketPath string
+	conn       net.Conn
+	x11        *x11Source // opened for the first node without a pid
+}
+
+// swayNode is the subset of a sway/i3 tree node used to find the focused window
+type swayNode struct {
+	Name             string     `json:"name"`
+	Type             string     `json:"type"`
+	Focused          bool       `json:"focused"`
+	PID              int        `json:"pid"`    // sway only
+	Window           uint32     `json:"window"` // X11 window id, for i3 and XWayland windows
+	AppID            string     `json:"app_id"`
+	Nodes            []swayNode `json:"nodes"`
+	FloatingNodes    []swayNode `json:"floating_nodes"`
+	WindowProperties struct {
+		Class string `json:"class"`
+		Title string `json:"title"`
+	} `json:"window_properties"`
+}
+
+// swaySocketPath returns the IPC socket advertised by sway or i3, or "" if neither is running
+func swaySocketPath() string {
+	if path := os.Getenv("SWAYSOCK"); path != "" {
+		return path
+	}
+	return os.Getenv("I3SOCK")
+}
+
+// newSwaySource returns a source that talks to the IPC socket at socketPath
+func newSwaySource(socketPath string) (*swaySource, error) {
+	if socketPath == "" {
+		return nil, errors.New("sway IPC socket not found (SWAYSOCK and I3SOCK are unset)")
+	}
+	return &swaySource{socketPath: socketPath}, nil
+}
+
+// FocusedWindow returns the exe and title of the focused node in the compositor's tree
+func (s *swaySource) FocusedWindow() (FocusedWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payload, err := s.request(swayIPCGetTree, nil)
+	if err != nil {
+		// The compositor may have restarted; reconnect on the next reading
+		if s.conn != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+		return FocusedWindow{}, err
+	}
+
+	var tree swayNode
+	if err := json.Unmarshal(payload, &tree); err != nil {
+		return FocusedWindow{}, fmt.Errorf("decode sway tree: %w", err)
+	}
+
+	node := findFocusedSwayNode(&tree)
+	if node == nil {
+		return FocusedWindow{}, errNoFocusedWindow
+	}
+
+	exePath, err := s.nodeExe(node)
+	if err != nil {
+		return FocusedWindow{}, err
+	}
+
+	title := node.Name
+	if title == "" {
+		title = node.WindowProperties.Title
+	}
+
+	return FocusedWindow{
+		ExePath: exePath,
+		Title:   title,
+	}, nil
+}
+
+// nodeExe resolves a window node to the exe of its process, through its pid or else its X11 window
+func (s *swaySource) nodeExe(node *swayNode) (string, error) {
+	if node.PID != 0 {
+		return os.Readlink(fmt.Sprintf("/proc/%d/exe", node.PID))
+	}
+	if node.Window == 0 {
+		return "", errNoFocusedWindow
+	}
+	if s.x11 == nil {
+		x11, err := newX11Source()
+		if err != nil {
+			return "", err
+		}
+		s.x11 = x11
+	}
+	s.x11.mu.Lock()
+	defer s.x11.mu.Unlock()
+	return s.x11.windowExe(xproto.Window(node.Window))
+}
+
+// request sends one IPC message and returns the payload of its reply
+func (s *swaySource) request(msgType uint32, payload []byte) ([]byte, error) {
+	if s.conn == nil {
+		conn, err := net.Dial("unix", s.socketPath)
+		if err != nil {
+			return nil, fmt.Errorf("connect to sway IPC: %w", err)
+		}
+		s.conn = conn
+	}
+
+	// Message layout: magic string, payload length, message type, payload (native byte order)
+	header := make([]byte, len(swayIPCMagic)+8)
+	copy(header, swayIPCMagic)
+	binary.NativeEndian.PutUint32(header[len(swayIPCMagic):], uint32(len(payload)))
+	binary.NativeEndian.PutUint32(header[len(swayIPCMagic)+4:], msgType)
+	if _, err := s.conn.Write(append(header, payload...)); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(swayIPCMagic)]) != swayIPCMagic {
+		return nil, errors.New("invalid sway IPC reply header")
+	}
+	length := binary.NativeEndian.Uint32(header[len(swayIPCMagic):])
+	replyType := binary.NativeEndian.Uint32(header[len(swayIPCMagic)+4:])
+	if replyType != msgType {
+		return nil, fmt.Errorf("unexpected sway IPC reply type %d", replyType)
+	}
+
+	reply := make([]byte, length)
+	if _, err := io.ReadFull(s.conn, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// findFocusedSwayNode walks the tree depth-first and returns the focused window node
+func findFocusedSwayNode(node *swayNode) *swayNode {
+	if node.Focused && (node.Type == "con" || node.Type == "floating_con") {
+		return node
+	}
+	for i := range node.Nodes {
+		if found := findFocusedSwayNode(&node.Nodes[i]); found != nil {
+			return found
+		}
+	}
+	for i := range node.FloatingNodes {
+		if found := findFocusedSwayNode(&node.FloatingNodes[i]); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// serveSwayTree answers GET_TREE requests on a unix socket in a temp folder with tree, and returns the socket path
+func serveSwayTree(t *testing.T, tree swayNode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sway-ipc.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	payload, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			header := make([]byte, len(swayIPCMagic)+8)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			if _, err := io.CopyN(io.Discard, conn, int64(binary.NativeEndian.Uint32(header[len(swayIPCMagic):]))); err != nil {
+				return
+			}
+			if binary.NativeEndian.Uint32(header[len(swayIPCMagic)+4:]) != swayIPCGetTree {
+				return
+			}
+			binary.NativeEndian.PutUint32(header[len(swayIPCMagic):], uint32(len(payload)))
+			if _, err := conn.Write(append(header, payload...)); err != nil {
+				return
+			}
+		}
+	}()
+	return path
+}
+
+func TestSwaySourceFocusedWindow(t *testing.T) {
+	exePath, err := os.Readlink("/proc/self/exe")
+	if err != nil {
+		t.Skip("no /proc on this system")
+	}
+
+	// An output holding a workspace with a split container; the focused window is the second leaf of the split
+	leaf := func(name string, pid int, focused bool) swayNode {
+		return swayNode{Name: name, Type: "con", PID: pid, Focused: focused}
+	}
+	floating := swayNode{Type: "floating_con", Name: "picture in picture", PID: 1}
+	tree := swayNode{Type: "root", Nodes: []swayNode{{
+		Type: "output",
+		Nodes: []swayNode{{
+			Type: "workspace",
+			Nodes: []swayNode{
+				leaf("editor", 1, false),
+				{Type: "con", Nodes: []swayNode{leaf("terminal", 1, false), leaf("Test window", os.Getpid(), true)}},
+			},
+			FloatingNodes: []swayNode{floating},
+		}},
+	}}}
+
+	source, err := newSwaySource(serveSwayTree(t, tree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each reading is a fresh GET_TREE request on the same connection
+	for i := 0; i < 2; i++ {
+		window, err := source.FocusedWindow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if window.ExePath != exePath || window.Title != "Test window" {
+			t.Errorf("got %+v, want %s with title %q", window, exePath, "Test window")
+		}
+	}
+}
+
+func TestFindFocusedSwayNode(t *testing.T) {
+	tests := []struct {
+		name string
+		tree swayNode
+		want string // name of the focused node, or "" for none
+	}{
+		{
+			name: "nested leaf",
+			tree: swayNode{Type: "root", Nodes: []swayNode{{Type: "workspace", Nodes: []swayNode{
+				{Type: "con", Name: "a"},
+				{Type: "con", Nodes: []swayNode{{Type: "con", Name: "b", Focused: true}}},
+			}}}},
+			want: "b",
+		},
+		{
+			name: "floating window",
+			tree: swayNode{Type: "root", Nodes: []swayNode{{Type: "workspace", Nodes: []swayNode{{Type: "con", Name: "a"}},
+				FloatingNodes: []swayNode{{Type: "floating_con", Name: "b", Focused: true}}}}},
+			want: "b",
+		},
+		{
+			name: "focused empty workspace",
+			tree: swayNode{Type: "root", Nodes: []swayNode{{Type: "workspace", Name: "2", Focused: true}}},
+			want: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ""
+			if node := findFocusedSwayNode(&test.tree); node != nil {
+				got = node.Name
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSwaySourceNodeWithoutProcess(t *testing.T) {
+	// A focused placeholder, such as an empty container being split, has neither a pid nor an X11 window
+	tree := swayNode{Type: "root", Nodes: []swayNode{{Type: "workspace", Nodes: []swayNode{{Type: "con", Focused: true}}}}}
+	source, err := newSwaySource(serveSwayTree(t, tree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.FocusedWindow(); err != errNoFocusedWindow {
+		t.Errorf("got error %v, want %v", err, errNoFocusedWindow)
+	}
+}
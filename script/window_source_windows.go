@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procGetWindowTextW = windows.NewLazySystemDLL("user32.dll").NewProc("GetWindowTextW")
+
+// win32Source reads the foreground window through the Win32 API
+type win32Source struct{}
+
+// newWindowSource returns the Win32 source; Windows has a single backend
+func newWindowSource(name string) (WindowSource, error) {
+	if name != "" && name != "win32" {
+		return nil, fmt.Errorf("unknown window source %q", name)
+	}
+	return win32Source{}, nil
+}
+
+// FocusedWindow resolves the foreground window to its process image path and title
+func (win32Source) FocusedWindow() (FocusedWindow, error) {
+	hwnd := windows.GetForegroundWindow()
+	if hwnd == 0 {
+		return FocusedWindow{}, errNoFocusedWindow
+	}
+
+	// Get process ID from window handle
+	var pid uint32
+	_, _ = windows.GetWindowThreadProcessId(hwnd, &pid)
+
+	// Get executable path from PID
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return FocusedWindow{}, err
+	}
+	defer windows.CloseHandle(handle)
+
+	var buf [windows.MAX_PATH]uint16
+	length := uint32(len(buf))
+	err = windows.QueryFullProcessImageName(handle, 0, &buf[0], &length)
+	if err != nil {
+		return FocusedWindow{}, err
+	}
+
+	return FocusedWindow{
+		ExePath: windows.UTF16ToString(buf[:length]),
+		Title:   windowText(hwnd),
+	}, nil
+}
+
+// windowText returns the title bar text of a window, or "" if it has none
+func windowText(hwnd windows.HWND) string {
+	var buf [512]uint16
+	n, _, _ := procGetWindowTextW.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	return windows.UTF16ToString(buf[:n])
+}
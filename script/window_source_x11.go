@@ -0,0 +1,118 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// x11Source reads the active window from an EWMH-compliant X11 window manager.
+// The window is resolved to a PID through _NET_WM_PID and then to an exe through /proc/<pid>/exe.
+type x11Source struct {
+	mu   sync.Mutex
+	conn *xgb.Conn
+	root xproto.Window
+
+	atomActiveWindow xproto.Atom
+	atomWMPid        xproto.Atom
+	atomWMName       xproto.Atom
+	atomUTF8String   xproto.Atom
+}
+
+// newX11Source connects to the display named by $DISPLAY and interns the EWMH atoms it needs
+func newX11Source() (*x11Source, error) {
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("connect to X server: %w", err)
+	}
+
+	s := &x11Source{
+		conn: conn,
+		root: xproto.Setup(conn).DefaultScreen(conn).Root,
+	}
+
+	atoms := map[string]*xproto.Atom{
+		"_NET_ACTIVE_WINDOW": &s.atomActiveWindow,
+		"_NET_WM_PID":        &s.atomWMPid,
+		"_NET_WM_NAME":       &s.atomWMName,
+		"UTF8_STRING":        &s.atomUTF8String,
+	}
+	for name, atom := range atoms {
+		reply, err := xproto.InternAtom(conn, false, uint16(len(name)), name).Reply()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("intern atom %s: %w", name, err)
+		}
+		*atom = reply.Atom
+	}
+
+	return s, nil
+}
+
+// FocusedWindow returns the exe and title of the window named by _NET_ACTIVE_WINDOW
+func (s *x11Source) FocusedWindow() (FocusedWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active, err := s.property32(s.root, s.atomActiveWindow, xproto.AtomWindow)
+	if err != nil {
+		return FocusedWindow{}, err
+	}
+	window := xproto.Window(active)
+	if window == 0 {
+		return FocusedWindow{}, errNoFocusedWindow
+	}
+
+	exePath, err := s.windowExe(window)
+	if err != nil {
+		return FocusedWindow{}, err
+	}
+
+	return FocusedWindow{
+		ExePath: exePath,
+		Title:   s.windowTitle(window),
+	}, nil
+}
+
+// windowExe resolves a window to the exe of its process through _NET_WM_PID
+func (s *x11Source) windowExe(window xproto.Window) (string, error) {
+	pid, err := s.property32(window, s.atomWMPid, xproto.AtomCardinal)
+	if err != nil {
+		return "", err
+	}
+	if pid == 0 {
+		return "", fmt.Errorf("window 0x%x has no _NET_WM_PID", window)
+	}
+	return os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+}
+
+// property32 reads a single 32-bit value of the given type from a window property
+func (s *x11Source) property32(window xproto.Window, property, typ xproto.Atom) (uint32, error) {
+	reply, err := xproto.GetProperty(s.conn, false, window, property, typ, 0, 1).Reply()
+	if err != nil {
+		return 0, err
+	}
+	if reply.Format != 32 || len(reply.Value) < 4 {
+		return 0, nil
+	}
+	return binary.LittleEndian.Uint32(reply.Value), nil
+}
+
+// windowTitle returns _NET_WM_NAME, falling back to the legacy WM_NAME property
+func (s *x11Source) windowTitle(window xproto.Window) string {
+	reply, err := xproto.GetProperty(s.conn, false, window, s.atomWMName, s.atomUTF8String, 0, 1024).Reply()
+	if err == nil && len(reply.Value) > 0 {
+		return string(reply.Value)
+	}
+	reply, err = xproto.GetProperty(s.conn, false, window, xproto.AtomWmName, xproto.AtomString, 0, 1024).Reply()
+	if err == nil {
+		return string(reply.Value)
+	}
+	return ""
+}
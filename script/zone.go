@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+	"time"
+	"trackerdata"
+)
+
+// zoneRefreshInterval is how often the system time zone is re-read, so travel is picked up while running
+const zoneRefreshInterval = time.Minute
+
+var (
+	zoneName    string
+	zoneLoc     *time.Location
+	zoneChecked time.Time
+	zoneMu      sync.Mutex
+)
+
+// recordingZone returns the name and location of the system time zone, as stored with each span.
+// The name is an IANA name where the platform reveals one, and a fixed offset such as +02:00 otherwise.
+func recordingZone() (string, *time.Location) {
+	zoneMu.Lock()
+	defer zoneMu.Unlock()
+
+	now := time.Now()
+	if zoneLoc != nil && now.Sub(zoneChecked) < zoneRefreshInterval {
+		return zoneName, zoneLoc
+	}
+	zoneChecked = now
+
+	if name, err := systemZoneName(); err == nil {
+		if loc, err := trackerdata.LoadZone(name); err == nil {
+			zoneName, zoneLoc = name, loc
+			return zoneName, zoneLoc
+		}
+	}
+
+	// Go keeps the zone it started with, so an unnamed zone can't follow a change made while running
+	name := trackerdata.OffsetZone(now)
+	loc, _ := trackerdata.LoadZone(name)
+	zoneName, zoneLoc = name, loc
+	return zoneName, zoneLoc
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// systemZoneName reads the IANA name of the system time zone from $TZ, the /etc/localtime symlink or /etc/timezone
+func systemZoneName() (string, error) {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" && !filepath.IsAbs(tz) {
+		return tz, nil
+	}
+
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if _, name, found := strings.Cut(target, "/zoneinfo/"); found {
+			return name, nil
+		}
+	}
+
+	if data, err := os.ReadFile("/etc/timezone"); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			return name, nil
+		}
+	}
+	return "", errors.New("system time zone has no name")
+}
@@ -2,14 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"trackerdata"
 )
 
 // Record
@@ -21,6 +23,11 @@ type Record struct {
 	date_id   int
 	date_info DateInfo
 	category  string
+	passive   bool // idle but audible (e.g. watching a lecture); reported separately from active time
+	counted   bool // the collector counted input, so keys, clicks and scrolls are meaningful
+	keys      int
+	clicks    int
+	scrolls   int
 }
 
 // DateInfo holds enriched information about a date
@@ -56,8 +63,14 @@ type CategoryItems struct {
 
 // Aggregation represents aggregated time across multiple records
 type Aggregation struct {
-	Groupers map[string]interface{} `json:"groupers"`
-	Duration int                    `json:"duration"` // total duration in seconds
+	Groupers        map[string]interface{} `json:"groupers"`
+	Duration        int                    `json:"duration"`         // total active duration in seconds
+	PassiveDuration int                    `json:"passive_duration"` // idle time with media playing, in seconds
+	Keys            int                    `json:"keys"`
+	Clicks          int                    `json:"clicks"`
+	Scrolls         int                    `json:"scrolls"`
+	InputDuration   int                    `json:"input_duration"` // seconds of active time where input was counted
+	Intensity       float64                `json:"intensity"`      // input events per minute of active time where input was counted
 }
 
 // CategoriesResponse is the shape returned to the frontend
@@ -75,8 +88,16 @@ type App struct {
 	category_order       []string                 // display order of categories
 	url_truncation_rules map[string][]string      // map of base domain to list of truncation patterns
 	dark_mode            bool
+	time_zone            string         // date bucketing preference: "recorded", "local" or an IANA zone name
+	date_zone            *time.Location // zone records are bucketed into dates in, nil to use the zone each span was recorded in
+	records_mu           sync.Mutex     // guards records and the loaded range, which GetAggregations fills on demand
+	loaded_from          int            // first date_id whose records are loaded
+	loaded_to            int            // last date_id whose records are loaded, 0 if none are
 }
 
+// maxDateID is the date_id used for a range with no end
+const maxDateID = 99991231
+
 // NewApp creates a new App application struct
 func NewApp() *App {
 	return &App{}
@@ -97,23 +118,107 @@ func (a *App) startup(ctx context.Context) {
 	a.loadURLTruncationRules()
 	// load dark mode preference
 	a.loadDarkMode()
+	// load the time zone dates are bucketed in
+	a.loadTimeZone()
 }
 
-// domReady is called after front-end resources have been loaded
+// domReady is called after front-end resources have been loaded. Records are loaded for each date range as
+// the frontend asks for it.
 func (a *App) domReady(ctx context.Context) {
-	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Now().Location())
-	end := time.Now()
+}
+
+// zoneSlack is how far a span's recording zone can put its date from the UTC date, so reading this much
+// beyond a range of dates covers every span that may be bucketed into them
+const zoneSlack = 14 * time.Hour
+
+// ensure_loaded makes sure the records of every date from start to end (date_ids, 0 for no bound) are loaded.
+// The loaded dates stay one continuous range: one outside it is loaded together with everything in between.
+func (a *App) ensure_loaded(start, end int) error {
+	if end == 0 {
+		end = maxDateID
+	}
+	if a.loaded_to != 0 && start >= a.loaded_from && end <= a.loaded_to {
+		return nil
+	}
+	if a.loaded_to != 0 {
+		start = min(start, a.loaded_from)
+		end = max(end, a.loaded_to)
+	}
+
+	a.records = []Record{}
+	a.loaded_from, a.loaded_to = 0, 0
+	if err := a.populate_range(start, end); err != nil {
+		return err
+	}
+	a.loaded_from, a.loaded_to = start, end
+	return nil
+}
+
+// populate_range loads the records of the dates from start to end (date_ids) from the store configured for
+// this machine. Spans are read as one continuous stream in time order, starting a week before the range so
+// that the session events still in effect at its start apply, and spans, pauses and sample intervals that
+// run past midnight carry over into the next date. File stores read only the day files of that stretch.
+func (a *App) populate_range(start, end int) error {
+	store, err := trackerdata.OpenConfiguredStore(trackerdata.Dir())
+	if err != nil {
+		return err
+	}
+	defer store.Close()
 
-	var dates []int // list of date_ids since 20200101
+	from, to := time.Time{}, time.Time{}
+	if start > 0 {
+		from = a.dateStart(start).Add(-zoneSlack)
+	}
+	if end < maxDateID {
+		to = nextMidnight(a.dateStart(end)).Add(zoneSlack)
+	}
+	read := from
+	if !from.IsZero() {
+		read = from.Add(-trackerdata.SpanLookback)
+	}
 
-	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
-		date_id := d.Year()*10000 + int(d.Month())*100 + d.Day()
-		dates = append(dates, date_id)
+	samples := []trackerdata.Sample{}
+	spans := []trackerdata.Span{}
+	samplesErr := store.Samples(from, to, func(sample trackerdata.Sample) error {
+		samples = append(samples, sample)
+		return nil
+	})
+	spansErr := store.Spans(read, to, func(span trackerdata.Span) error {
+		spans = append(spans, span)
+		return nil
+	})
+
+	// Legacy samples count as the spans they consolidate into, which is also what compacted days hold
+	consolidated := trackerdata.ConsolidateSamples(samples, time.Time{})
+	spans = append(consolidated, spans...)
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	a.populate_spans(spans)
+
+	// Dates at the edges of what was read may be missing spans, so only the range itself is kept
+	records := a.records[:0]
+	for _, record := range a.records {
+		if record.date_id >= start && record.date_id <= end {
+			records = append(records, record)
+		}
+	}
+	a.records = records
+
+	for _, err := range []error{samplesErr, spansErr} {
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	for _, date_id := range dates {
-		a.populate_date(date_id)
+// dateStart returns the midnight starting a date_id, in the zone dates are bucketed in, or UTC if that is
+// each span's own zone
+func (a *App) dateStart(date_id int) time.Time {
+	loc := a.date_zone
+	if loc == nil {
+		loc = time.UTC
 	}
+	return time.Date(date_id/10000, time.Month(date_id/100%100), date_id%100, 0, 0, 0, 0, loc)
 }
 
 // beforeClose is called when the application is about to quit,
@@ -139,7 +244,7 @@ Desired Functionality
 */
 
 func (a *App) populate_categories() error {
-	data_dir := filepath.Join(os.Getenv("LOCALAPPDATA"), "tracker_data")
+	data_dir := trackerdata.Dir()
 	data_file_path := filepath.Join(data_dir, "preferences.json")
 
 	// Try to read existing preferences
@@ -215,7 +320,7 @@ func (a *App) populate_categories() error {
 // saveCategories persists the current reverse_categories to preferences.json,
 // preserving other keys like url_truncation
 func (a *App) saveCategories() error {
-	data_dir := filepath.Join(os.Getenv("LOCALAPPDATA"), "tracker_data")
+	data_dir := trackerdata.Dir()
 	data_file_path := filepath.Join(data_dir, "preferences.json")
 
 	// Read existing file to preserve other keys
@@ -249,7 +354,7 @@ func (a *App) saveCategories() error {
 
 // loadDarkMode reads the dark_mode key from preferences.json into app state
 func (a *App) loadDarkMode() {
-	data_dir := filepath.Join(os.Getenv("LOCALAPPDATA"), "tracker_data")
+	data_dir := trackerdata.Dir()
 	data_file_path := filepath.Join(data_dir, "preferences.json")
 
 	file, err := os.Open(data_file_path)
@@ -270,7 +375,7 @@ func (a *App) loadDarkMode() {
 
 // saveDarkMode writes the dark_mode key to preferences.json, preserving other keys
 func (a *App) saveDarkMode() error {
-	data_dir := filepath.Join(os.Getenv("LOCALAPPDATA"), "tracker_data")
+	data_dir := trackerdata.Dir()
 	data_file_path := filepath.Join(data_dir, "preferences.json")
 
 	rawConfig := map[string]json.RawMessage{}
@@ -302,6 +407,107 @@ func (a *App) SetDarkMode(darkMode bool) {
 	a.dark_mode = darkMode
 }
 
+// TimeZoneRecorded and TimeZoneLocal are the time_zone preferences that aren't IANA zone names
+const (
+	TimeZoneRecorded = "recorded" // bucket each span by the zone it was recorded in (the default)
+	TimeZoneLocal    = "local"    // bucket everything by this computer's current zone
+)
+
+// loadTimeZone reads the time_zone key from preferences.json into app state
+func (a *App) loadTimeZone() {
+	a.time_zone = TimeZoneRecorded
+	a.date_zone = nil
+
+	data_dir := trackerdata.Dir()
+	data_file_path := filepath.Join(data_dir, "preferences.json")
+
+	file, err := os.Open(data_file_path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var rawConfig map[string]json.RawMessage
+	if err := json.NewDecoder(file).Decode(&rawConfig); err != nil {
+		return
+	}
+
+	var name string
+	if timeZoneRaw, exists := rawConfig["time_zone"]; exists && json.Unmarshal(timeZoneRaw, &name) == nil {
+		if loc, err := dateZone(name); err == nil {
+			a.time_zone = name
+			a.date_zone = loc
+		}
+	}
+}
+
+// saveTimeZone writes the time_zone key to preferences.json, preserving other keys
+func (a *App) saveTimeZone() error {
+	data_dir := trackerdata.Dir()
+	data_file_path := filepath.Join(data_dir, "preferences.json")
+
+	rawConfig := map[string]json.RawMessage{}
+	if file, err := os.Open(data_file_path); err == nil {
+		json.NewDecoder(file).Decode(&rawConfig)
+		file.Close()
+	}
+
+	timeZoneBytes, err := json.Marshal(a.time_zone)
+	if err != nil {
+		return err
+	}
+	rawConfig["time_zone"] = timeZoneBytes
+
+	output, err := json.MarshalIndent(rawConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(data_file_path, output, 0644)
+}
+
+// dateZone resolves a time_zone preference to the zone dates are bucketed in, nil meaning the recording zone
+func dateZone(name string) (*time.Location, error) {
+	switch name {
+	case TimeZoneRecorded, "":
+		return nil, nil
+	case TimeZoneLocal:
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// GetTimeZone returns the time zone preference dates are bucketed by
+func (a *App) GetTimeZone() string {
+	return a.time_zone
+}
+
+// SetTimeZone changes the time zone dates are bucketed by, saves it and reloads the records
+func (a *App) SetTimeZone(name string) error {
+	loc, err := dateZone(name)
+	if err != nil {
+		return fmt.Errorf("unknown time zone '%s'", name)
+	}
+	if name == "" {
+		name = TimeZoneRecorded
+	}
+	a.time_zone = name
+	a.date_zone = loc
+
+	a.records_mu.Lock()
+	a.records = []Record{}
+	a.loaded_from, a.loaded_to = 0, 0
+	a.records_mu.Unlock()
+	return a.saveTimeZone()
+}
+
+// inDateZone returns t in the zone records are bucketed in
+func (a *App) inDateZone(t time.Time) time.Time {
+	if a.date_zone != nil {
+		return t.In(a.date_zone)
+	}
+	return t
+}
+
 // GetCategories returns the categories and their display order for the frontend
 func (a *App) GetCategories() CategoriesResponse {
 	return CategoriesResponse{
@@ -370,6 +576,8 @@ func (a *App) ReorderCategories(order []string) error {
 
 // recategorizeRecords re-applies categorization to all loaded records
 func (a *App) recategorizeRecords() {
+	a.records_mu.Lock()
+	defer a.records_mu.Unlock()
 	for i := range a.records {
 		a.records[i].category = a.categorize(a.records[i].exe_path, a.records[i].url)
 	}
@@ -387,7 +595,7 @@ func removeFromSlice(slice []string, item string) []string {
 
 // loadURLTruncationRules loads URL truncation patterns from preferences.json
 func (a *App) loadURLTruncationRules() error {
-	data_dir := filepath.Join(os.Getenv("LOCALAPPDATA"), "tracker_data")
+	data_dir := trackerdata.Dir()
 	data_file_path := filepath.Join(data_dir, "preferences.json")
 
 	file, err := os.Open(data_file_path)
@@ -501,159 +709,66 @@ func (a *App) truncateURL(rawURL string) string {
 	return host
 }
 
-// populate_records takes in the raw data from the CSV, header and all, and populates the App's records slice.
-// CSV format: name, timestamp, tabName, tabUrl, hadActivity
-// Consolidates consecutive identical records and discards periods with 2+ minutes of continuous inactivity
-func (a *App) populate_records(records [][]string) error {
-	if len(records) < 2 {
-		return nil // need at least header + 1 data row
-	}
-
-	// Track accumulated record state
-	var currentExePath, currentUrl, currentName string
-	var currentDateId int
-	var accumulatedDuration int = 0
-	var inactiveStreak int = 0
-
-	// Helper to check if two records represent the same activity
-	isSameActivity := func(exePath1, url1, name1, exePath2, url2, name2 string) bool {
-		return exePath1 == exePath2 && url1 == url2 && name1 == name2
-	}
-
-	// Helper to flush accumulated record
-	flushRecord := func() {
-		if accumulatedDuration > 0 {
-			record := Record{
-				duration:  accumulatedDuration,
-				exe_path:  currentExePath,
-				url:       currentUrl,
-				name:      currentName,
-				date_id:   currentDateId,
-				date_info: a.enrich_date(currentDateId),
-				category:  a.categorize(currentExePath, currentUrl),
-			}
-			a.records = append(a.records, record)
-		}
-		// Reset all state
-		currentExePath = ""
-		currentUrl = ""
-		currentName = ""
-		currentDateId = 0
-		accumulatedDuration = 0
-		inactiveStreak = 0
-	}
-
-	// Iterate through consecutive pairs of readings (skip header row at index 0)
-	for i := 1; i < len(records)-1; i++ {
-		if len(records[i]) < 5 {
-			continue // skip malformed rows
-		}
-
-		exePath := records[i][0]
-		timestamp := records[i][1]
-		tabName := records[i][2]
-		tabUrl := records[i][3]
-		hadActivityStr := records[i][4]
-
-		// Skip if app was off or asleep
-		if exePath == "Off" {
-			flushRecord()
-			continue
-		}
-
-		// Parse timestamps
-		currentTime, err := time.Parse(time.RFC3339, timestamp)
-		if err != nil {
-			continue
-		}
-		nextTime, err := time.Parse(time.RFC3339, records[i+1][1])
-		if err != nil {
+// populate_spans takes in the rows of span files, in order, and populates the App's records slice.
+// Open spans are checkpointed with the same start time, so only the last row for each start is kept.
+// Session event markers clip spans at sleep, lock and exit. Inactive spans are discarded unless audible,
+// in which case they become passive records. Spans that cross midnight are split so each date gets its own share.
+func (a *App) populate_spans(spans []trackerdata.Span) error {
+	for _, row := range trackerdata.ApplySessionEvents(spans) {
+		// Skip session markers and idle time without media playing
+		if !row.Counted() {
 			continue
 		}
 
-		// Calculate duration
-		duration := int(nextTime.Sub(currentTime).Seconds())
-		if duration > 15 {
-			// Likely computer was off or asleep
-			flushRecord()
-			continue
-		}
+		url := a.truncateURL(row.TabUrl)
+		category := a.categorize(row.Name, url)
+		total := row.End.Sub(row.Start)
+
+		// Split at each midnight the span crosses, sharing its input counts out by time.
+		// Midnights come from the zone's own calendar, so days with a DST change are 23 or 25 hours long.
+		rowEnd := a.inDateZone(row.End)
+		for start := a.inDateZone(row.Start); start.Before(rowEnd); {
+			end := nextMidnight(start)
+			if end.After(rowEnd) {
+				end = rowEnd
+			}
+			share := float64(end.Sub(start)) / float64(total)
 
-		// Parse hadActivity
-		hadActivity := hadActivityStr == "true"
-		date_id := currentTime.Year()*10000 + int(currentTime.Month())*100 + currentTime.Day()
-
-		if !hadActivity {
-			// Inactive period
-			if currentExePath != "" && isSameActivity(currentExePath, currentUrl, currentName, exePath, tabUrl, tabName) {
-				// Same activity - add to inactive streak
-				inactiveStreak += duration
-				// If inactive streak reaches 2 minutes, flush and reset (don't include the inactive time)
-				if inactiveStreak >= 120 {
-					flushRecord()
-				}
-			} else {
-				// Different activity or not started - flush previous if exists, don't start new
-				if currentExePath != "" {
-					flushRecord()
-				}
-				// Don't count this inactive time for the different/new activity
+			date_id := dateID(start)
+			record := Record{
+				duration:  int(end.Sub(start).Seconds()),
+				exe_path:  row.Name,
+				url:       url,
+				name:      row.TabName,
+				date_id:   date_id,
+				date_info: a.enrich_date(date_id),
+				category:  category,
+				passive:   !row.HadActivity,
 			}
-		} else {
-			// Active period
-			if currentExePath == "" {
-				// Start new record
-				currentExePath = exePath
-				currentUrl = a.truncateURL(tabUrl)
-				currentName = tabName
-				currentDateId = date_id
-				accumulatedDuration = duration
-				inactiveStreak = 0
-			} else if isSameActivity(currentExePath, currentUrl, currentName, exePath, tabUrl, tabName) {
-				// Same activity - add inactive streak (if < 2 min) + current duration
-				if inactiveStreak < 120 {
-					accumulatedDuration += inactiveStreak + duration
-				} else {
-					// Inactive streak was >= 2 min, so we already flushed
-					// This shouldn't happen due to the flush above, but handle it
-					accumulatedDuration = duration
-				}
-				inactiveStreak = 0
-			} else {
-				// Different activity - flush previous and start new
-				flushRecord()
-				currentExePath = exePath
-				currentUrl = a.truncateURL(tabUrl)
-				currentName = tabName
-				currentDateId = date_id
-				accumulatedDuration = duration
-				inactiveStreak = 0
+			if row.Input != nil {
+				record.counted = true
+				record.keys = int(float64(row.Input.Keys)*share + 0.5)
+				record.clicks = int(float64(row.Input.Clicks)*share + 0.5)
+				record.scrolls = int(float64(row.Input.Scrolls)*share + 0.5)
 			}
+			if record.duration > 0 {
+				a.records = append(a.records, record)
+			}
+			start = end
 		}
 	}
-	// Flush any remaining accumulated record
-	flushRecord()
 	return nil
 }
 
-// populate_date reads the CSV file for the given date and populates the records on that date.
-func (a *App) populate_date(date int) error {
-	data_dir := filepath.Join(os.Getenv("LOCALAPPDATA"), "tracker_data")
-	data_file_path := filepath.Join(data_dir, fmt.Sprintf("%d.csv", date))
-
-	f, err := os.Open(data_file_path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+// nextMidnight returns the start of the day after t, in t's time zone
+func nextMidnight(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+}
 
-	reader := csv.NewReader(f)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return err
-	}
-	a.populate_records(records)
-	return nil
+// dateID returns the YYYYMMDD date_id of t, in t's time zone
+func dateID(t time.Time) int {
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
 }
 
 // categorize takes in an application name and URL, and returns the category it belongs to, according to the predefined categories.
@@ -711,10 +826,24 @@ func (a *App) enrich_date(date_id int) DateInfo {
 	}
 }
 
-// GetAggregations aggregates records based on specified groupers and filters
+// GetAggregations aggregates records based on specified groupers and filters. The records of the dates the
+// filters select are loaded first if they haven't been.
 func (a *App) GetAggregations(grouperNames []string, filters map[string]string) []Aggregation {
+	a.records_mu.Lock()
+	defer a.records_mu.Unlock()
+
+	startDate, endDate := 0, 0
+	fmt.Sscanf(filters["start_date"], "%d", &startDate)
+	fmt.Sscanf(filters["end_date"], "%d", &endDate)
+	if err := a.ensure_loaded(startDate, endDate); err != nil {
+		fmt.Fprintf(os.Stderr, "load records: %v\n", err)
+	}
+
 	// Map to accumulate durations: aggregation key -> duration
 	aggregationMap := make(map[string]int)
+	passiveMap := make(map[string]int)
+	// Maps to accumulate input counts, and the active time they were counted over
+	inputMap := make(map[string]inputTotals)
 	// Map to store grouper values: aggregation key -> grouper values
 	grouperValuesMap := make(map[string]map[string]interface{})
 
@@ -738,23 +867,61 @@ func (a *App) GetAggregations(grouperNames []string, filters map[string]string)
 		// Create unique key for this combination of grouper values
 		key := strings.Join(keyParts, "|")
 
-		// Accumulate duration
-		aggregationMap[key] += record.duration
+		// Accumulate duration, keeping passive media time separate
+		if record.passive {
+			passiveMap[key] += record.duration
+			if _, exists := aggregationMap[key]; !exists {
+				aggregationMap[key] = 0 // list the group even if it has no active time
+			}
+		} else {
+			aggregationMap[key] += record.duration
+		}
+		if record.counted && !record.passive {
+			totals := inputMap[key]
+			totals.duration += record.duration
+			totals.keys += record.keys
+			totals.clicks += record.clicks
+			totals.scrolls += record.scrolls
+			inputMap[key] = totals
+		}
 		grouperValuesMap[key] = grouperValues
 	}
 
 	// Convert map to slice of Aggregation structs
 	aggregations := []Aggregation{}
 	for key, duration := range aggregationMap {
+		input := inputMap[key]
 		aggregations = append(aggregations, Aggregation{
-			Groupers: grouperValuesMap[key],
-			Duration: duration,
+			Groupers:        grouperValuesMap[key],
+			Duration:        duration,
+			PassiveDuration: passiveMap[key],
+			Keys:            input.keys,
+			Clicks:          input.clicks,
+			Scrolls:         input.scrolls,
+			InputDuration:   input.duration,
+			Intensity:       input.intensity(),
 		})
 	}
 
 	return aggregations
 }
 
+// inputTotals accumulates input counts over the active time they were counted in
+type inputTotals struct {
+	duration int // seconds of active time with input counts
+	keys     int
+	clicks   int
+	scrolls  int
+}
+
+// intensity returns input events per minute of active time, or 0 if no input was counted
+func (t inputTotals) intensity() float64 {
+	if t.duration <= 0 {
+		return 0
+	}
+	return float64(t.keys+t.clicks+t.scrolls) / (float64(t.duration) / 60)
+}
+
 // matchesFilters checks if a record matches all specified filters
 func (a *App) matchesFilters(record Record, filters map[string]string) bool {
 	for key, value := range filters {
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"maps"
+	"testing"
+	"time"
+	"trackerdata"
+)
+
+// dateTotals returns the seconds recorded on each date_id
+func dateTotals(records []Record) map[int]int {
+	totals := map[int]int{}
+	for _, record := range records {
+		totals[record.date_id] += record.duration
+	}
+	return totals
+}
+
+// recordedSpan returns an active span between two wall clock times in a zone, as a store returns it
+func recordedSpan(t *testing.T, name string, zone string, from, to string) trackerdata.Span {
+	t.Helper()
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse := func(s string) time.Time {
+		at, err := time.ParseInLocation(time.DateTime, s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+	return trackerdata.Span{Name: name, Start: parse(from), End: parse(to), HadActivity: true, Zone: zone}
+}
+
+// recordedMarker returns a session event marker at a wall clock time in a zone
+func recordedMarker(t *testing.T, name string, zone string, at string) trackerdata.Span {
+	t.Helper()
+	marker := recordedSpan(t, name, zone, at, at)
+	marker.HadActivity = false
+	return marker
+}
+
+func TestPopulateSpans(t *testing.T) {
+	tests := []struct {
+		name      string
+		time_zone string // the time_zone preference
+		spans     []trackerdata.Span
+		want      map[int]int
+	}{
+		{
+			name:      "split at midnight",
+			time_zone: TimeZoneRecorded,
+			spans:     []trackerdata.Span{recordedSpan(t, "app", "UTC", "2024-03-01 23:00:00", "2024-03-02 01:30:00")},
+			want:      map[int]int{20240301: 3600, 20240302: 5400},
+		},
+		{
+			// Day files read in turn: checkpoints of the open span in its start day's file, then the next
+			// day's file with the lock that ended it and what followed
+			name:      "span ending in the next day's file",
+			time_zone: TimeZoneRecorded,
+			spans: []trackerdata.Span{
+				recordedSpan(t, "editor", "UTC", "2024-03-01 23:30:00", "2024-03-01 23:45:00"),
+				recordedSpan(t, "editor", "UTC", "2024-03-01 23:30:00", "2024-03-02 01:00:00"),
+				recordedMarker(t, "@locked", "UTC", "2024-03-02 00:15:00"),
+				recordedMarker(t, "@unlocked", "UTC", "2024-03-02 00:20:00"),
+				recordedSpan(t, "browser", "UTC", "2024-03-02 00:20:00", "2024-03-02 00:30:00"),
+			},
+			want: map[int]int{20240301: 1800, 20240302: 900 + 600},
+		},
+		{
+			name:      "spring forward day has 23 hours",
+			time_zone: "America/New_York",
+			spans:     []trackerdata.Span{recordedSpan(t, "app", "America/New_York", "2024-03-10 00:00:00", "2024-03-11 01:00:00")},
+			want:      map[int]int{20240310: 23 * 3600, 20240311: 3600},
+		},
+		{
+			name:      "fall back day has 25 hours",
+			time_zone: "America/New_York",
+			spans:     []trackerdata.Span{recordedSpan(t, "app", "America/New_York", "2024-11-03 00:00:00", "2024-11-04 01:00:00")},
+			want:      map[int]int{20241103: 25 * 3600, 20241104: 3600},
+		},
+		{
+			name:      "recording zone's DST day",
+			time_zone: TimeZoneRecorded,
+			spans:     []trackerdata.Span{recordedSpan(t, "app", "Europe/Berlin", "2024-10-27 00:00:00", "2024-10-28 00:00:00")},
+			want:      map[int]int{20241027: 25 * 3600},
+		},
+		{
+			name:      "dated in the recording zone",
+			time_zone: TimeZoneRecorded,
+			spans:     []trackerdata.Span{recordedSpan(t, "app", "Asia/Tokyo", "2024-03-02 08:00:00", "2024-03-02 10:00:00")},
+			want:      map[int]int{20240302: 7200},
+		},
+		{
+			name:      "recorded in one zone, dated in another",
+			time_zone: "UTC",
+			spans:     []trackerdata.Span{recordedSpan(t, "app", "Asia/Tokyo", "2024-03-02 08:00:00", "2024-03-02 10:00:00")},
+			want:      map[int]int{20240301: 3600, 20240302: 3600},
+		},
+		{
+			name:      "spans from two zones dated in a third",
+			time_zone: "America/New_York",
+			spans: []trackerdata.Span{
+				recordedSpan(t, "laptop", "Europe/London", "2024-06-01 03:00:00", "2024-06-01 06:00:00"), // 22:00-01:00 in New York
+				recordedSpan(t, "phone", "Asia/Tokyo", "2024-06-01 22:00:00", "2024-06-01 23:00:00"),     // 09:00-10:00
+			},
+			want: map[int]int{20240531: 2 * 3600, 20240601: 2 * 3600},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &App{}
+			loc, err := dateZone(test.time_zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.time_zone, a.date_zone = test.time_zone, loc
+
+			if err := a.populate_spans(test.spans); err != nil {
+				t.Fatal(err)
+			}
+			if got := dateTotals(a.records); !maps.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPopulateRangeReadsDayFilesAsOneStream(t *testing.T) {
+	dir := t.TempDir()
+	trackerdata.SetDir(dir)
+	defer trackerdata.SetDir("")
+
+	// The span open at midnight is stored with March 1st; the lock that ended it with March 2nd
+	store, err := trackerdata.OpenStore(trackerdata.BackendCSV, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append([]trackerdata.Span{
+		recordedSpan(t, "earlier", "UTC", "2024-03-01 09:00:00", "2024-03-01 10:00:00"),
+		recordedSpan(t, "editor", "UTC", "2024-03-01 23:30:00", "2024-03-02 01:00:00"),
+		recordedMarker(t, "@locked", "UTC", "2024-03-02 00:15:00"),
+		recordedMarker(t, "@unlocked", "UTC", "2024-03-02 00:20:00"),
+		recordedSpan(t, "browser", "UTC", "2024-03-02 00:20:00", "2024-03-02 00:30:00"),
+		recordedSpan(t, "later", "UTC", "2024-03-03 09:00:00", "2024-03-03 10:00:00"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &App{time_zone: TimeZoneRecorded}
+	if err := a.populate_range(20240302, 20240302); err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]int{}
+	for _, record := range a.records {
+		if record.date_id != 20240302 {
+			t.Errorf("loaded a record for %d", record.date_id)
+		}
+		names[record.exe_path] += record.duration
+	}
+	if want := map[string]int{"editor": 900, "browser": 600}; !maps.Equal(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
@@ -1,6 +1,12 @@
 export type Aggregation = {
   groupers: Record<string, any>;
   duration: number;
+  passive_duration: number;
+  keys: number;
+  clicks: number;
+  scrolls: number;
+  input_duration: number; // seconds of active time where input was counted
+  intensity: number; // input events per active minute
 };
 
 export type DataPoint = {
@@ -16,3 +22,9 @@ export function formatDuration(seconds: number, hoursOnly?: boolean): string {
   if (hours > 0) return `${hours}h ${minutes}m`;
   return `${minutes}m`;
 }
+
+// Formats input events per minute over the seconds input was counted in; empty if input wasn't counted
+export function formatIntensity(inputEvents: number, countedSeconds: number): string {
+  if (countedSeconds <= 0) return "";
+  return `${Math.round(inputEvents / (countedSeconds / 60))}/min`;
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"embed"
+	"flag"
 	"log"
+	"trackerdata"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/logger"
@@ -18,6 +20,11 @@ var assets embed.FS
 var icon []byte
 
 func main() {
+	// Read data from the same folder as the collector unless told otherwise
+	dataDir := flag.String("data-dir", "", "folder the collector keeps tracked data in (default $"+trackerdata.DirEnv+" or the per-user data folder)")
+	flag.Parse()
+	trackerdata.SetDir(*dataDir)
+
 	// Create an instance of the app structure
 	app := NewApp()
 
@@ -0,0 +1,246 @@
+package trackerdata
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// CompactedSuffix ends the name of a compacted day file: the day's spans, consolidated and gzipped
+const CompactedSuffix = ".spans.csv.gz"
+
+// Rules the dashboard has always applied to legacy samples
+const (
+	legacySampleInterval = 5 * time.Second   // how often the old collector wrote a sample
+	legacySampleGap      = 15 * time.Second  // samples further apart mean the computer was off or asleep
+	legacyIdleLimit      = 120 * time.Second // an inactive streak this long ends a span and isn't counted
+)
+
+// ConsolidateSamples turns legacy samples, in order, into the active spans they count as. Consecutive samples
+// of the same app and tab are merged. Inactive samples only count when they are followed by an active one of
+// the same app and tab within two minutes. An Off row, or samples more than 15 seconds apart, end a span.
+// next is the time of the sample after the last one; if it is zero the last sample counts for the 5-second
+// sample interval.
+func ConsolidateSamples(samples []Sample, next time.Time) []Span {
+	spans := []Span{}
+	var current *Span
+	var inactive time.Duration
+	flush := func() {
+		if current != nil && current.End.After(current.Start) {
+			spans = append(spans, *current)
+		}
+		current = nil
+		inactive = 0
+	}
+
+	for i, sample := range samples {
+		if sample.Name == "Off" {
+			flush()
+			continue
+		}
+
+		end := sample.Timestamp.Add(legacySampleInterval)
+		if i+1 < len(samples) {
+			end = samples[i+1].Timestamp
+		} else if !next.IsZero() {
+			end = next
+		}
+		duration := end.Sub(sample.Timestamp).Truncate(time.Second)
+		if duration > legacySampleGap {
+			flush()
+			continue
+		}
+
+		same := current != nil && current.Name == sample.Name && current.TabUrl == sample.TabUrl && current.TabName == sample.TabName
+		switch {
+		case !sample.HadActivity && same:
+			inactive += duration
+			if inactive >= legacyIdleLimit {
+				flush()
+			}
+		case !sample.HadActivity:
+			flush()
+		case same:
+			current.End = current.End.Add(inactive + duration)
+			inactive = 0
+		default:
+			flush()
+			current = &Span{
+				Name:        sample.Name,
+				Start:       sample.Timestamp,
+				End:         sample.Timestamp.Add(duration),
+				TabName:     sample.TabName,
+				TabUrl:      sample.TabUrl,
+				HadActivity: true,
+				Zone:        OffsetZone(sample.Timestamp),
+			}
+		}
+	}
+	flush()
+	return spans
+}
+
+// CompactResult describes one day handled by CompactDayFiles
+type CompactResult struct {
+	Day   string
+	Files []string // the day files that were, or would be, compacted
+	Spans int      // spans in the compacted file
+	Err   error
+}
+
+// CompactDayFiles replaces the day files in dir for days before the given YYYYMMDD with one compacted file
+// per day (YYYYMMDD.spans.csv.gz). Legacy samples are consolidated into spans and only the latest checkpoint
+// of each span is kept, so the file holds exactly what the dashboard counts. The originals are moved into
+// the archive folder and made read-only. Compacting is repeatable: a day that was interrupted, or already
+// compacted, comes out the same. With dryRun set nothing is changed.
+func CompactDayFiles(dir string, before string, dryRun bool) ([]CompactResult, error) {
+	files, err := ListDayFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group the files by day
+	days := [][]DayFile{}
+	for _, file := range files {
+		if n := len(days); n > 0 && days[n-1][0].Day == file.Day {
+			days[n-1] = append(days[n-1], file)
+		} else {
+			days = append(days, []DayFile{file})
+		}
+	}
+
+	results := []CompactResult{}
+	for i, group := range days {
+		day := group[0].Day
+		if day >= before {
+			break
+		}
+		if len(group) == 1 && group[0].Name == day+CompactedSuffix {
+			continue
+		}
+
+		result := CompactResult{Day: day}
+		spans := []Span{}
+		samples := []Sample{}
+		for _, file := range group {
+			result.Files = append(result.Files, file.Name)
+			if file.Spans {
+				fileSpans, err := readSpanDayFile(filepath.Join(dir, file.Name))
+				if err != nil && result.Err == nil {
+					result.Err = err
+				}
+				spans = append(spans, fileSpans...)
+			} else {
+				fileSamples, err := ReadSampleFile(filepath.Join(dir, file.Name))
+				if err != nil && result.Err == nil {
+					result.Err = err
+				}
+				samples = append(samples, fileSamples...)
+			}
+		}
+
+		// The last sample lasts until the first one of the next file, as when the days are read as one stream
+		next := time.Time{}
+		if i+1 < len(days) {
+			next = firstSample(dir, days[i+1])
+		}
+
+		spans = append(spans, ConsolidateSamples(samples, next)...)
+		sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+		spans = latestCheckpoints(spans)
+		result.Spans = len(spans)
+
+		if result.Err == nil && !dryRun {
+			result.Err = writeCompacted(dir, day, spans)
+		}
+		if result.Err == nil && !dryRun {
+			for _, file := range group {
+				if file.Name == day+CompactedSuffix {
+					continue
+				}
+				if err := archiveDayFile(dir, file.Name); err != nil {
+					result.Err = err
+					break
+				}
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// firstSample returns the time of the first sample in a day's files, or zero if it has none
+func firstSample(dir string, files []DayFile) time.Time {
+	for _, file := range files {
+		if file.Spans {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, file.Name))
+		if err != nil {
+			return time.Time{}
+		}
+		defer f.Close()
+		if sample, err := NewSampleReader(f).Read(); err == nil {
+			return sample.Timestamp
+		}
+	}
+	return time.Time{}
+}
+
+// writeCompacted writes a day's compacted file, replacing any earlier one only once the new one is complete
+func writeCompacted(dir string, day string, spans []Span) error {
+	path := filepath.Join(dir, day+CompactedSuffix)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path + ".tmp")
+
+	gz := gzip.NewWriter(f)
+	w := csv.NewWriter(gz)
+	// Columns added by a newer version are kept after the known ones
+	extra := extraColumns(spans)
+	err = writeHeader(w, spanKind, SpanSchemaVersion, append(append([]string{}, spanColumns...), extra...))
+	for _, span := range spans {
+		if err != nil {
+			break
+		}
+		err = w.Write(spanRow(span, extra))
+	}
+	if err == nil {
+		w.Flush()
+		err = w.Error()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readCompactedFile reads every span in a compacted day file
+func readCompactedFile(path string) ([]Span, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return readSpans(gz)
+}
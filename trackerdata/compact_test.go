@@ -0,0 +1,36 @@
+package trackerdata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompactKeepsNewerColumns(t *testing.T) {
+	dir := t.TempDir()
+
+	// A day file from a newer version, with a column this one doesn't know between two it does
+	file := "#trackerdata spans 4\n" +
+		"name,start,end,tabName,tabUrl,hadActivity,audible,keys,clicks,scrolls,mood,zone\n" +
+		"editor,2024-03-01T09:00:00Z,2024-03-01T10:00:00Z,,,true,false,,,,focused,UTC\n" +
+		"browser,2024-03-01T10:00:00Z,2024-03-01T11:00:00Z,,,true,false,,,,,UTC\n"
+	if err := os.WriteFile(filepath.Join(dir, "20240301.spans.csv"), []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CompactDayFiles(dir, "20240302", false); err != nil {
+		t.Fatal(err)
+	}
+	spans, err := readCompactedFile(filepath.Join(dir, "20240301"+CompactedSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSpans(t, spans, []Span{{Name: "editor", Start: at(9), End: at(10), HadActivity: true, Zone: "UTC"},
+		{Name: "browser", Start: at(10), End: at(11), HadActivity: true, Zone: "UTC"}})
+	if got := spans[0].Extra["mood"]; got != "focused" {
+		t.Errorf("editor mood = %q, want focused", got)
+	}
+	if got, ok := spans[1].Extra["mood"]; !ok || got != "" {
+		t.Errorf("browser mood = %q (present %v), want an empty cell", got, ok)
+	}
+}
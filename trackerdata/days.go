@@ -0,0 +1,192 @@
+package trackerdata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ArchiveDir is the folder in the data folder that day files are moved to once imported into the database
+// or compacted
+const ArchiveDir = "archive"
+
+// DayFile is a span file (YYYYMMDD.spans.csv, YYYYMMDD.spans.jsonl, or YYYYMMDD.spans.csv.gz once compacted)
+// or legacy sample file (YYYYMMDD.csv) in the data folder
+type DayFile struct {
+	Name  string // file name
+	Day   string // YYYYMMDD in the zone it was recorded in
+	Spans bool   // a span file rather than a legacy sample file
+}
+
+// ListDayFiles returns the day files in dir, oldest first, with a date's sample file before its span files
+func ListDayFiles(dir string) ([]DayFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []DayFile{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if file, ok := parseDayFile(entry.Name()); ok {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Day != files[j].Day {
+			return files[i].Day < files[j].Day
+		}
+		if files[i].Spans != files[j].Spans {
+			return !files[i].Spans
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// parseDayFile recognises the name of a day file
+func parseDayFile(name string) (DayFile, bool) {
+	day, spans := strings.CutSuffix(name, ".spans.csv")
+	if !spans {
+		day, spans = strings.CutSuffix(name, ".spans.jsonl")
+	}
+	if !spans {
+		day, spans = strings.CutSuffix(name, CompactedSuffix)
+	}
+	if !spans {
+		var ok bool
+		if day, ok = strings.CutSuffix(name, ".csv"); !ok {
+			return DayFile{}, false
+		}
+	}
+	if len(day) != 8 || strings.Trim(day, "0123456789") != "" {
+		return DayFile{}, false
+	}
+	return DayFile{Name: name, Day: day, Spans: spans}, true
+}
+
+// listArchivedFiles returns the day files in the archive folder of dir, oldest first. A file archived when the
+// archive already held one of the same name is kept under that name plus a number (20240301.spans.csv.1).
+func listArchivedFiles(dir string) ([]DayFile, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, ArchiveDir))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []DayFile{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if i := strings.LastIndexByte(name, '.'); i >= 0 && i+1 < len(name) && strings.Trim(name[i+1:], "0123456789") == "" {
+			name = name[:i]
+		}
+		if file, ok := parseDayFile(name); ok {
+			file.Name = entry.Name()
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Day != files[j].Day {
+			return files[i].Day < files[j].Day
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// ImportResult describes one day file handled by ImportDayFiles
+type ImportResult struct {
+	File string
+	Rows int
+	Err  error
+}
+
+// ImportDayFiles imports the day files in dir for days before the given YYYYMMDD into the database,
+// then moves each into the archive folder and makes it read-only. Files are imported one transaction each,
+// so an interrupted import can simply be run again. With dryRun set nothing is changed, and Rows is what
+// would be imported.
+func ImportDayFiles(db *DB, dir string, before string, dryRun bool) ([]ImportResult, error) {
+	files, err := ListDayFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	imported, err := db.ImportedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []ImportResult{}
+	for _, file := range files {
+		if file.Day >= before {
+			continue // the collector may still be writing it
+		}
+		path := filepath.Join(dir, file.Name)
+		result := ImportResult{File: file.Name}
+
+		switch {
+		case dryRun:
+			result.Rows, result.Err = countRows(path, file.Spans)
+		case imported[file.Name]:
+			// Imported before but never archived; finish the job
+		default:
+			result.Rows, result.Err = db.importFile(path, file.Name)
+		}
+
+		if result.Err == nil && !dryRun {
+			result.Err = archiveDayFile(dir, file.Name)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// archiveDayFile moves a day file into the archive folder and makes it read-only. A copy archived earlier
+// under the same name is never replaced; the file is numbered instead.
+func archiveDayFile(dir string, name string) error {
+	archive := filepath.Join(dir, ArchiveDir)
+	if err := os.MkdirAll(archive, 0755); err != nil {
+		return err
+	}
+	archived := filepath.Join(archive, name)
+	for n := 1; ; n++ {
+		_, err := os.Lstat(archived)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		archived = filepath.Join(archive, fmt.Sprintf("%s.%d", name, n))
+	}
+	if err := os.Rename(filepath.Join(dir, name), archived); err != nil {
+		return err
+	}
+	return os.Chmod(archived, 0444)
+}
+
+// countRows returns the number of rows a day file would import
+func countRows(path string, spans bool) (int, error) {
+	if spans {
+		rows, err := readSpanDayFile(path)
+		return len(rows), err
+	}
+	rows, err := ReadSampleFile(path)
+	return len(rows), err
+}
+
+// readSpanDayFile reads every span in a span file of any format
+func readSpanDayFile(path string) ([]Span, error) {
+	switch {
+	case strings.HasSuffix(path, ".jsonl"):
+		return ReadJSONLSpanFile(path)
+	case strings.HasSuffix(path, ".gz"):
+		return readCompactedFile(path)
+	}
+	return ReadSpanFile(path)
+}
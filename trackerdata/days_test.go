@@ -0,0 +1,58 @@
+package trackerdata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveDayFileKeepsEarlierCopies(t *testing.T) {
+	dir := t.TempDir()
+	name := "20240301.spans.csv"
+
+	// The same day is archived three times, e.g. compacted again after a late checkpoint recreated its file
+	for _, content := range []string{"first", "second", "third"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := archiveDayFile(dir, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{name: "first", name + ".1": "second", name + ".2": "third"}
+	for file, content := range want {
+		data, err := os.ReadFile(filepath.Join(dir, ArchiveDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s holds %q, want %q", file, data, content)
+		}
+	}
+
+	files, err := listArchivedFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if file.Day != "20240301" || !file.Spans {
+			t.Errorf("archived %s read as %+v", file.Name, file)
+		}
+	}
+	if len(files) != len(want) {
+		t.Errorf("listed %d archived files, want %d", len(files), len(want))
+	}
+
+	// Deleting the day deletes every copy
+	if err := removeDayFiles(dir, "20240301", ""); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, ArchiveDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("left %s in the archive", entry.Name())
+	}
+}
@@ -0,0 +1,77 @@
+// Package trackerdata holds what the collector and the dashboard share about the data folder.
+package trackerdata
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// DirEnv overrides the data folder for both the collector and the dashboard
+const DirEnv = "TRACKER_DATA_DIR"
+
+// dirName is the folder created under the platform's per-user data location
+const dirName = "tracker_data"
+
+var (
+	dirOverride string
+	dirMu       sync.Mutex
+)
+
+// SetDir overrides the data folder, e.g. from a -data-dir flag. It takes precedence over TRACKER_DATA_DIR.
+// An empty dir removes the override.
+func SetDir(dir string) {
+	dirMu.Lock()
+	defer dirMu.Unlock()
+	dirOverride = dir
+}
+
+// Dir returns the data folder. In order of precedence:
+//   - the folder passed to SetDir
+//   - $TRACKER_DATA_DIR
+//   - Windows: %LOCALAPPDATA%\tracker_data
+//   - macOS: ~/Library/Application Support/tracker_data
+//   - Linux and other Unix: $XDG_DATA_HOME/tracker_data, or ~/.local/share/tracker_data
+//
+// If no home folder can be found the data folder falls back to ./tracker_data.
+func Dir() string {
+	dirMu.Lock()
+	override := dirOverride
+	dirMu.Unlock()
+	if override != "" {
+		return override
+	}
+	if dir := os.Getenv(DirEnv); dir != "" {
+		return dir
+	}
+	return defaultDir()
+}
+
+// defaultDir returns the platform's per-user data location
+func defaultDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		if base := os.Getenv("LOCALAPPDATA"); base != "" {
+			return filepath.Join(base, dirName)
+		}
+	case "darwin":
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, "Library", "Application Support", dirName)
+		}
+	default:
+		// XDG_DATA_HOME must be absolute to count; relative values are ignored per the spec
+		if base := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(base) {
+			return filepath.Join(base, dirName)
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".local", "share", dirName)
+		}
+	}
+	return dirName
+}
+
+// Path returns the location of a file in the data folder
+func Path(name string) string {
+	return filepath.Join(Dir(), name)
+}
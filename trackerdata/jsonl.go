@@ -0,0 +1,231 @@
+package trackerdata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// jsonlHeader is the first line of a YYYYMMDD.spans.jsonl file, and is written again when a newer
+// version appends to a file started by an older one
+type jsonlHeader struct {
+	Kind    string `json:"trackerdata"`
+	Version int    `json:"version"`
+}
+
+// jsonlSpan is a span as one line of a YYYYMMDD.spans.jsonl file. Keys match the span file's column names.
+type jsonlSpan struct {
+	Name        string `json:"name"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	TabName     string `json:"tabName,omitempty"`
+	TabUrl      string `json:"tabUrl,omitempty"`
+	HadActivity bool   `json:"hadActivity"`
+	Audible     bool   `json:"audible"`
+	Keys        *int   `json:"keys,omitempty"`
+	Clicks      *int   `json:"clicks,omitempty"`
+	Scrolls     *int   `json:"scrolls,omitempty"`
+	Zone        string `json:"zone,omitempty"`
+}
+
+// JSONLSpanReader reads spans from a JSON lines span file
+type JSONLSpanReader struct {
+	s       *bufio.Scanner
+	version int
+}
+
+// NewJSONLSpanReader returns a reader for the JSON lines span file in r
+func NewJSONLSpanReader(r io.Reader) *JSONLSpanReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024) // titles and URLs can be long
+	return &JSONLSpanReader{s: s, version: 1}
+}
+
+// Read returns the next span, skipping lines that aren't JSON objects or whose times don't parse.
+// Keys this package doesn't know go into Extra. It returns io.EOF at the end of the file.
+func (r *JSONLSpanReader) Read() (Span, error) {
+	for r.s.Scan() {
+		line := bytes.TrimSpace(r.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		var object map[string]any
+		if err := decoder.Decode(&object); err != nil {
+			continue // a line cut short by a crash
+		}
+		if kind, ok := object["trackerdata"].(string); ok {
+			if kind == spanKind {
+				if version, ok := object["version"].(json.Number); ok {
+					v, _ := version.Int64()
+					r.version = int(v)
+				}
+			}
+			continue
+		}
+
+		// Lay the object out as a row under the span file's columns, then unknown keys
+		row := make([]string, len(spanColumns))
+		for i, name := range spanColumns {
+			row[i] = jsonCell(object[name])
+			delete(object, name)
+		}
+		header := spanColumns
+		if len(object) > 0 {
+			extra := make([]string, 0, len(object))
+			for name := range object {
+				extra = append(extra, name)
+			}
+			sort.Strings(extra)
+			header = append(append([]string{}, spanColumns...), extra...)
+			for _, name := range extra {
+				row = append(row, jsonCell(object[name]))
+			}
+		}
+
+		if span, ok := parseSpan(newColumns(header, spanColumns), row); ok {
+			return span, nil
+		}
+	}
+	if err := r.s.Err(); err != nil {
+		return Span{}, err
+	}
+	return Span{}, io.EOF
+}
+
+// Version returns the schema version of the section of the file read last
+func (r *JSONLSpanReader) Version() int {
+	return r.version
+}
+
+// jsonCell formats a decoded JSON value the way it would appear in a CSV cell
+func jsonCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// ReadJSONLSpanFile reads every span in a JSON lines span file
+func ReadJSONLSpanFile(path string) ([]Span, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	spans := []Span{}
+	reader := NewJSONLSpanReader(f)
+	for {
+		span, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return spans, nil
+		}
+		if err != nil {
+			return spans, err
+		}
+		spans = append(spans, span)
+	}
+}
+
+// JSONLSpanWriter appends spans to a JSON lines span file
+type JSONLSpanWriter struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+// OpenJSONLSpanFile opens a JSON lines span file for appending. A new file, or one last written by
+// another version, gets a header line first.
+func OpenJSONLSpanFile(path string) (*JSONLSpanWriter, error) {
+	version := 0
+	if f, err := os.Open(path); err == nil {
+		reader := NewJSONLSpanReader(f)
+		for {
+			if _, err := reader.Read(); err != nil {
+				break
+			}
+		}
+		version = reader.Version()
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &JSONLSpanWriter{f: f, w: bufio.NewWriter(f)}
+	if version != SpanSchemaVersion {
+		if err := w.writeLine(jsonlHeader{Kind: spanKind, Version: SpanSchemaVersion}); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Write buffers a span. Extra keys are not written.
+func (w *JSONLSpanWriter) Write(span Span) error {
+	line := jsonlSpan{
+		Name:        span.Name,
+		Start:       span.Start.UTC().Format(time.RFC3339),
+		End:         span.End.UTC().Format(time.RFC3339),
+		TabName:     span.TabName,
+		TabUrl:      span.TabUrl,
+		HadActivity: span.HadActivity,
+		Audible:     span.Audible,
+		Zone:        span.Zone,
+	}
+	if span.Input != nil {
+		input := *span.Input
+		line.Keys, line.Clicks, line.Scrolls = &input.Keys, &input.Clicks, &input.Scrolls
+	}
+	return w.writeLine(line)
+}
+
+func (w *JSONLSpanWriter) writeLine(value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(append(data, '\n'))
+	return err
+}
+
+// Flush writes buffered spans to the file
+func (w *JSONLSpanWriter) Flush() error {
+	return w.w.Flush()
+}
+
+// Sync flushes buffered spans and commits the file to disk
+func (w *JSONLSpanWriter) Sync() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// Close flushes buffered spans and closes the file
+func (w *JSONLSpanWriter) Close() error {
+	err := w.Flush()
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
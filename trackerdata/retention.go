@@ -0,0 +1,391 @@
+package trackerdata
+
+import (
+	"sort"
+	"time"
+)
+
+// RetentionPolicy limits how long detail is kept. Each setting is a number of days; 0 keeps that detail forever.
+type RetentionPolicy struct {
+	StripTitlesAfterDays int `json:"strip_titles_after_days"` // remove tab and window titles
+	DomainsOnlyAfterDays int `json:"domains_only_after_days"` // reduce URLs to their domain
+	AggregateAfterDays   int `json:"aggregate_after_days"`    // keep only the daily total per app and tab
+}
+
+// RetentionResult describes what ApplyRetention changed, or would change, for one day
+type RetentionResult struct {
+	Day            string
+	Rows           int  // spans and legacy samples stored for the day before
+	Kept           int  // spans stored for the day after
+	TitlesStripped int  // spans whose title was removed
+	URLsReduced    int  // spans whose URL was reduced to its domain
+	Aggregated     bool // the day was reduced to daily totals
+	Archived       bool // raw copies of the day in the archive folder were deleted
+	Err            error
+}
+
+// archiver is implemented by the stores that keep raw copies of days in the archive folder
+type archiver interface {
+	archived() (map[string]bool, error)
+}
+
+func (s *fileStore) archived() (map[string]bool, error) {
+	return archivedDays(s.dir)
+}
+
+func (s *sqliteStore) archived() (map[string]bool, error) {
+	return archivedDays(s.files.dir)
+}
+
+// ApplyRetention enforces a policy on the days before today (YYYYMMDD). A day past any of the policy's limits
+// is rewritten with only what the policy allows: legacy samples become the spans they count as, titles and
+// URLs are stripped, and once a day is aggregated it holds one span per app, tab and activity state, laid
+// end to end from midnight. Its raw copies in the archive folder are deleted. Days that already comply are
+// left alone, so running it again changes nothing. With dryRun set nothing is changed.
+func ApplyRetention(store Store, policy RetentionPolicy, today string, dryRun bool) ([]RetentionResult, error) {
+	date, err := time.Parse("20060102", today)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := func(days int) string {
+		if days <= 0 {
+			return ""
+		}
+		return date.AddDate(0, 0, -days).Format("20060102")
+	}
+	stripBefore := cutoff(policy.StripTitlesAfterDays)
+	domainsBefore := cutoff(policy.DomainsOnlyAfterDays)
+	aggregateBefore := cutoff(policy.AggregateAfterDays)
+	last := max(stripBefore, domainsBefore, aggregateBefore)
+	if last == "" {
+		return nil, nil
+	}
+
+	// Read the days the policy applies to, up to a day past them to cover every zone. Only markers are kept
+	// after that, since a pause can be resumed days later and only then excludes the time before it.
+	lastDate, _ := time.Parse("20060102", last)
+	to := lastDate.AddDate(0, 0, 1)
+	spansByDay := map[string][]Span{}
+	if err := store.Spans(time.Time{}, time.Time{}, func(span Span) error {
+		if span.Start.Before(to) || span.IsMarker() {
+			spansByDay[span.Day()] = append(spansByDay[span.Day()], span)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	samplesByDay := map[string][]Sample{}
+	if err := store.Samples(time.Time{}, to, func(sample Sample) error {
+		day := sample.Timestamp.Format("20060102")
+		samplesByDay[day] = append(samplesByDay[day], sample)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	archived := map[string]bool{}
+	if a, ok := store.(archiver); ok {
+		if archived, err = a.archived(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows := map[string]int{}
+	for day, spans := range spansByDay {
+		rows[day] = len(spans)
+	}
+	sampleDays := []string{}
+	for day, samples := range samplesByDay {
+		rows[day] += len(samples)
+		sampleDays = append(sampleDays, day)
+	}
+	sort.Strings(sampleDays)
+
+	// Legacy samples become the spans they count as. A day's last sample lasts until the next day's first,
+	// as when the days are read as one stream.
+	for i, day := range sampleDays {
+		next := time.Time{}
+		if i+1 < len(sampleDays) {
+			next = samplesByDay[sampleDays[i+1]][0].Timestamp
+		}
+		spans := append(ConsolidateSamples(samplesByDay[day], next), spansByDay[day]...)
+		sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+		spansByDay[day] = spans
+	}
+
+	days := []string{}
+	for day := range spansByDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	// Strip titles and URLs first, so that aggregated days are grouped without them
+	results := map[string]*RetentionResult{}
+	for _, day := range days {
+		if day >= last {
+			break
+		}
+		result := &RetentionResult{Day: day}
+		results[day] = result
+		for i := range spansByDay[day] {
+			span := &spansByDay[day][i]
+			if day < stripBefore && span.TabName != "" {
+				span.TabName = ""
+				result.TitlesStripped++
+			}
+			if day < domainsBefore {
+				if domain := Domain(span.TabUrl); domain != span.TabUrl {
+					span.TabUrl = domain
+					result.URLsReduced++
+				}
+			}
+		}
+	}
+
+	var totals map[string][]Span
+	var carry []Span
+	carried := false
+	if aggregateBefore != "" {
+		totals, carry = aggregateDays(spansByDay, days, aggregateBefore)
+		// A span can run through days that have nothing stored; they get its time too
+		totalDays := []string{}
+		for day := range totals {
+			totalDays = append(totalDays, day)
+		}
+		days = mergeDays(days, totalDays)
+		// Time past the last aggregated day is stored with the day after it, which may be rewritten in turn
+		if len(carry) > 0 && aggregateBefore < last {
+			spansByDay[aggregateBefore] = append(carry, spansByDay[aggregateBefore]...)
+			carry, carried = nil, true
+			days = mergeDays(days, []string{aggregateBefore})
+		}
+	}
+	for day := range archived {
+		if day < last {
+			days = mergeDays(days, []string{day})
+		}
+	}
+
+	list := []RetentionResult{}
+	for _, day := range days {
+		if day >= last {
+			break
+		}
+		result := results[day]
+		if result == nil {
+			result = &RetentionResult{Day: day}
+		}
+		result.Rows = rows[day]
+		result.Archived = archived[day]
+
+		spans := spansByDay[day]
+		if day < aggregateBefore {
+			result.Aggregated = !sameSpans(totals[day], spans)
+			spans = totals[day]
+		}
+		result.Kept = len(spans)
+
+		changed := len(samplesByDay[day]) > 0 || result.Archived || result.TitlesStripped > 0 || result.URLsReduced > 0 ||
+			result.Aggregated || (carried && day == aggregateBefore)
+		if !changed {
+			continue
+		}
+		if !dryRun {
+			result.Err = store.ReplaceDay(day, spans)
+		}
+		list = append(list, *result)
+	}
+
+	// Nothing else rewrites the day after the last aggregated one, so its carried time is added to it
+	if len(carry) > 0 && !dryRun {
+		if err := store.Append(carry); err != nil {
+			return list, err
+		}
+	}
+	return list, nil
+}
+
+// aggregateDays reduces each day before the given YYYYMMDD to what it counts: one span per app, tab and
+// activity state with its total time, laid end to end from midnight in the day's zone. Session events are
+// applied to the days' spans as one stream first, and time is split at midnight as the dashboard does.
+// It also returns what the day after the last aggregated one needs to count the same: the parts of the
+// aggregated days' spans that run into it, led by a marker at midnight for each pause that was still in effect.
+func aggregateDays(spansByDay map[string][]Span, days []string, before string) (totals map[string][]Span, carry []Span) {
+	// Stream every day's spans in order, remembering the day each was stored on
+	rows := []Span{}
+	origin := []string{}
+	for _, day := range days {
+		for _, span := range spansByDay[day] {
+			rows = append(rows, span)
+			origin = append(origin, day)
+		}
+	}
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return rows[order[i]].Start.Before(rows[order[j]].Start) })
+
+	// Collapse checkpoints as ApplySessionEvents does, then apply the session events
+	stream := []Span{}
+	streamOrigin := []string{}
+	for _, i := range order {
+		n := len(stream) - 1
+		if n >= 0 && stream[n].Name == rows[i].Name && stream[n].Start.Equal(rows[i].Start) {
+			stream[n] = rows[i]
+		} else {
+			stream = append(stream, rows[i])
+			streamOrigin = append(streamOrigin, origin[i])
+		}
+	}
+	clipSessions(stream)
+
+	type key struct {
+		name, url, title string
+		active, counted  bool
+	}
+	type groupTotal struct {
+		span   Span
+		length time.Duration
+	}
+	type dayTotals struct {
+		loc  *time.Location
+		zone string
+		sums map[key]*groupTotal
+		keys []key
+	}
+	byDay := map[string]*dayTotals{}
+	paused := map[string]Span{} // the last marker of each kind of pause that hasn't been resumed
+	for i, row := range stream {
+		if streamOrigin[i] >= before {
+			continue
+		}
+		if row.IsMarker() {
+			if _, pauses := sessionPauseEvents[row.Name]; pauses {
+				paused[row.Name] = row
+			} else if sessionEndEvents[row.Name] {
+				clear(paused)
+			}
+			for pause, resume := range sessionPauseEvents {
+				if row.Name == resume {
+					delete(paused, pause)
+				}
+			}
+			continue
+		}
+		if !row.Counted() {
+			continue
+		}
+
+		loc := row.location()
+		total := row.End.Sub(row.Start)
+		share := func(from, to time.Time) *InputCounts {
+			if row.Input == nil {
+				return nil
+			}
+			f := float64(to.Sub(from)) / float64(total)
+			return &InputCounts{
+				Keys:    int(float64(row.Input.Keys)*f + 0.5),
+				Clicks:  int(float64(row.Input.Clicks)*f + 0.5),
+				Scrolls: int(float64(row.Input.Scrolls)*f + 0.5),
+			}
+		}
+
+		// Split at each midnight the span crosses. Time from the first day that isn't aggregated is carried.
+		rowEnd := row.End.In(loc)
+		for start := row.Start.In(loc); start.Before(rowEnd); {
+			day := start.Format("20060102")
+			if day >= before {
+				part := row
+				part.Start = start
+				part.Input = share(part.Start, part.End)
+				carry = append(carry, part)
+				break
+			}
+			year, month, date := start.Date()
+			end := time.Date(year, month, date+1, 0, 0, 0, 0, loc)
+			if end.After(rowEnd) {
+				end = rowEnd
+			}
+
+			group := byDay[day]
+			if group == nil {
+				group = &dayTotals{loc: loc, zone: recordedZone(row.Zone, row.Start), sums: map[key]*groupTotal{}}
+				byDay[day] = group
+			}
+			k := key{row.Name, row.TabUrl, row.TabName, row.HadActivity, row.Input != nil}
+			sum, ok := group.sums[k]
+			if !ok {
+				sum = &groupTotal{span: Span{Name: row.Name, TabUrl: row.TabUrl, TabName: row.TabName, HadActivity: row.HadActivity, Audible: !row.HadActivity}}
+				if row.Input != nil {
+					sum.span.Input = &InputCounts{}
+				}
+				group.sums[k] = sum
+				group.keys = append(group.keys, k)
+			}
+			sum.length += end.Sub(start)
+			if input := share(start, end); input != nil {
+				sum.span.Input.Keys += input.Keys
+				sum.span.Input.Clicks += input.Clicks
+				sum.span.Input.Scrolls += input.Scrolls
+			}
+			start = end
+		}
+	}
+	markers := []Span{}
+	for _, marker := range paused {
+		midnight, _ := time.ParseInLocation("20060102", before, marker.location())
+		marker.Start, marker.End = midnight, midnight
+		markers = append(markers, marker)
+	}
+	sort.Slice(markers, func(i, j int) bool { return markers[i].Name < markers[j].Name })
+	carry = append(markers, carry...)
+
+	totals = map[string][]Span{}
+	for day, group := range byDay {
+		keys := group.keys
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := keys[i], keys[j]
+			switch {
+			case a.name != b.name:
+				return a.name < b.name
+			case a.url != b.url:
+				return a.url < b.url
+			case a.title != b.title:
+				return a.title < b.title
+			case a.active != b.active:
+				return a.active
+			}
+			return a.counted && !b.counted
+		})
+		// Totals are whole seconds, which every store keeps exactly
+		at, _ := time.ParseInLocation("20060102", day, group.loc)
+		for _, k := range keys {
+			length := group.sums[k].length.Round(time.Second)
+			if length == 0 {
+				continue
+			}
+			span := group.sums[k].span
+			span.Start, span.End = at, at.Add(length)
+			span.Zone = group.zone
+			totals[day] = append(totals[day], span)
+			at = span.End
+		}
+	}
+	return totals, carry
+}
+
+// sameSpans reports whether two lists hold the same spans in the same order
+func sameSpans(a, b []Span) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		if x.Name != y.Name || !x.Start.Equal(y.Start) || !x.End.Equal(y.End) || x.TabName != y.TabName ||
+			x.TabUrl != y.TabUrl || x.HadActivity != y.HadActivity || x.Audible != y.Audible || x.Zone != y.Zone ||
+			(x.Input == nil) != (y.Input == nil) || (x.Input != nil && *x.Input != *y.Input) {
+			return false
+		}
+	}
+	return true
+}
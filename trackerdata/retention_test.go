@@ -0,0 +1,91 @@
+package trackerdata
+
+import (
+	"maps"
+	"testing"
+	"time"
+)
+
+// countedTotals returns the time each app counts on each day, as the dashboard computes it: session events
+// applied to everything read, and spans split at each midnight in their zone
+func countedTotals(t *testing.T, store Store) map[string]map[string]time.Duration {
+	t.Helper()
+	totals := map[string]map[string]time.Duration{}
+	for _, span := range ApplySessionEvents(readStore(t, store, time.Time{}, time.Time{})) {
+		if !span.Counted() {
+			continue
+		}
+		loc := span.location()
+		end := span.End.In(loc)
+		for start := span.Start.In(loc); start.Before(end); {
+			year, month, date := start.Date()
+			midnight := time.Date(year, month, date+1, 0, 0, 0, 0, loc)
+			if midnight.After(end) {
+				midnight = end
+			}
+			day := start.Format("20060102")
+			if totals[day] == nil {
+				totals[day] = map[string]time.Duration{}
+			}
+			totals[day][span.Name] += midnight.Sub(start)
+			start = midnight
+		}
+	}
+	return totals
+}
+
+func TestApplyRetentionKeepsTotals(t *testing.T) {
+	store := NewMemoryStore()
+	store.Append([]Span{
+		testSpan("editor", 9, 10),
+		{Name: "@locked", Start: at(9.5), End: at(9.5), Zone: "UTC"}, // ends the editor span early
+		testSpan("video", 22, 50),                                    // stored on March 1st, runs through all of March 2nd into March 3rd
+		testSpan("browser", 58, 59),
+	})
+	before := countedTotals(t, store)
+
+	// March 1st and 2nd are aggregated; March 3rd isn't
+	policy := RetentionPolicy{AggregateAfterDays: 3}
+	if _, err := ApplyRetention(store, policy, "20240306", false); err != nil {
+		t.Fatal(err)
+	}
+	after := countedTotals(t, store)
+	if !maps.EqualFunc(before, after, maps.Equal) {
+		t.Errorf("totals changed by retention:\nbefore %v\nafter  %v", before, after)
+	}
+	if days, _ := store.Days(); len(days) != 3 {
+		t.Errorf("got days %v, want March 1st to 3rd", days)
+	}
+
+	// Running it again changes nothing
+	results, err := ApplyRetention(store, policy, "20240306", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("second run changed %+v", results)
+	}
+	if again := countedTotals(t, store); !maps.EqualFunc(before, again, maps.Equal) {
+		t.Errorf("totals changed by the second run:\nbefore %v\nafter  %v", before, again)
+	}
+}
+
+func TestApplyRetentionSeesLaterResume(t *testing.T) {
+	// Time recorded while locked is dropped by the unlock, days after the last day retention rewrites
+	store := NewMemoryStore()
+	store.Append([]Span{
+		testSpan("editor", 9, 10),
+		{Name: "@locked", Start: at(20), End: at(20), Zone: "UTC"},
+		testSpan("screensaver", 20.5, 21),
+		{Name: "@unlocked", Start: at(106), End: at(106), Zone: "UTC"},
+		testSpan("browser", 107, 108),
+	})
+	before := countedTotals(t, store)
+
+	if _, err := ApplyRetention(store, RetentionPolicy{AggregateAfterDays: 3}, "20240306", false); err != nil {
+		t.Fatal(err)
+	}
+	if after := countedTotals(t, store); !maps.EqualFunc(before, after, maps.Equal) {
+		t.Errorf("totals changed by retention:\nbefore %v\nafter  %v", before, after)
+	}
+}
@@ -0,0 +1,78 @@
+package trackerdata
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// sampleColumns is the layout of the legacy 5-second sample files (YYYYMMDD.csv).
+// Nothing writes them any more; they are only read.
+var sampleColumns = []string{"name", "timestamp", "tabName", "tabUrl", "hadActivity"}
+
+// Sample is a row of a legacy sample file: the focused app and tab at one instant
+type Sample struct {
+	Name        string
+	Timestamp   time.Time
+	TabName     string
+	TabUrl      string
+	HadActivity bool
+	Extra       map[string]string
+}
+
+// SampleReader reads samples from a legacy sample file
+type SampleReader struct {
+	t *tableReader
+}
+
+// NewSampleReader returns a reader for the sample file in r
+func NewSampleReader(r io.Reader) *SampleReader {
+	return &SampleReader{t: newTableReader(r, "samples", sampleColumns)}
+}
+
+// Read returns the next sample, skipping rows whose timestamp doesn't parse. It returns io.EOF at the end of the file.
+func (r *SampleReader) Read() (Sample, error) {
+	for {
+		row, err := r.t.next()
+		if err != nil {
+			return Sample{}, err
+		}
+		cols := r.t.cols
+
+		timestamp, err := time.Parse(time.RFC3339, cols.get(row, "timestamp"))
+		if err != nil {
+			continue
+		}
+		return Sample{
+			Name:        cols.get(row, "name"),
+			Timestamp:   timestamp,
+			TabName:     cols.get(row, "tabName"),
+			TabUrl:      cols.get(row, "tabUrl"),
+			HadActivity: cols.get(row, "hadActivity") == "true",
+			Extra:       cols.extra(row),
+		}, nil
+	}
+}
+
+// ReadSampleFile reads every sample in a legacy sample file
+func ReadSampleFile(path string) ([]Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	samples := []Sample{}
+	reader := NewSampleReader(f)
+	for {
+		sample, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return samples, nil
+		}
+		if err != nil {
+			return samples, err
+		}
+		samples = append(samples, sample)
+	}
+}
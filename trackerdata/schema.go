@@ -0,0 +1,118 @@
+package trackerdata
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// versionTag starts the line that precedes each header: "#trackerdata <kind> <version>".
+// Files without one predate versioning and count as version 1.
+const versionTag = "#trackerdata"
+
+// columns maps column names to their positions under the most recent header of a file
+type columns struct {
+	index   map[string]int
+	names   []string
+	current []string // the newest layout this package knows, used for cells past the end of the header
+}
+
+func newColumns(header []string, current []string) columns {
+	c := columns{index: map[string]int{}, names: header, current: current}
+	for i, name := range header {
+		c.index[name] = i
+	}
+	return c
+}
+
+// get returns the named cell of a row, or "" if the file doesn't have that column
+func (c columns) get(row []string, name string) string {
+	if i, ok := c.index[name]; ok && i < len(row) {
+		return row[i]
+	}
+	// Before versioning, newer collectors appended longer rows to files started with a shorter header.
+	// Cells past the end of the header follow the layout that was current when they were written.
+	for i, known := range c.current {
+		if known == name && i >= len(c.names) && i < len(row) {
+			return row[i]
+		}
+	}
+	return ""
+}
+
+// extra returns the cells of columns this package doesn't know about, so that a day file rewritten by
+// compaction or retention keeps them
+func (c columns) extra(row []string) map[string]string {
+	var extra map[string]string
+	for i, name := range c.names {
+		if i >= len(row) || contains(c.current, name) {
+			continue
+		}
+		if extra == nil {
+			extra = map[string]string{}
+		}
+		extra[name] = row[i]
+	}
+	return extra
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// tableReader reads the data rows of a CSV file, following version lines and headers wherever they appear
+type tableReader struct {
+	r       *csv.Reader
+	kind    string
+	current []string
+	cols    columns
+	version int
+	header  bool // the next row is a header
+}
+
+func newTableReader(r io.Reader, kind string, current []string) *tableReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // rows may be longer or shorter than their header
+	return &tableReader{r: reader, kind: kind, current: current, version: 1, header: true}
+}
+
+// next returns the next data row, or io.EOF at the end of the file
+func (t *tableReader) next() ([]string, error) {
+	for {
+		row, err := t.r.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(row) == 1 && strings.HasPrefix(row[0], versionTag+" ") {
+			var kind string
+			var version int
+			if _, err := fmt.Sscanf(row[0], versionTag+" %s %d", &kind, &version); err != nil || kind != t.kind {
+				return nil, fmt.Errorf("not a %s file: %q", t.kind, row[0])
+			}
+			t.version = version
+			t.header = true
+			continue
+		}
+		if t.header {
+			t.cols = newColumns(row, t.current)
+			t.header = false
+			continue
+		}
+		return row, nil
+	}
+}
+
+// writeHeader starts a section of a file with the version line and the header
+func writeHeader(w *csv.Writer, kind string, version int, header []string) error {
+	if err := w.Write([]string{fmt.Sprintf("%s %s %d", versionTag, kind, version)}); err != nil {
+		return err
+	}
+	return w.Write(header)
+}
@@ -0,0 +1,82 @@
+package trackerdata
+
+import "strings"
+
+// Session event markers written by the collector in place of an app name.
+// Stop events end whatever span was open. Pause events also exclude time until their matching resume event,
+// unless the collector session ends first.
+var (
+	sessionStopEvents = map[string]bool{
+		"Off": true, "@suspend": true, "@locked": true, "@shutdown": true, "@sigterm": true,
+		"@crash_recovered": true, "@tracking_paused": true,
+	}
+	sessionEndEvents   = map[string]bool{"Off": true, "@shutdown": true, "@sigterm": true, "@crash_recovered": true}
+	sessionPauseEvents = map[string]string{"@suspend": "@resume", "@locked": "@unlocked", "@tracking_paused": "@tracking_resumed"}
+)
+
+// IsMarker reports whether a span is a session event marker rather than time spent in an app
+func (s Span) IsMarker() bool {
+	return strings.HasPrefix(s.Name, "@") || s.Name == "Off"
+}
+
+// Counted reports whether a span's time counts: it isn't a marker, and it was active or had media playing.
+// Idle time with media playing counts as passive.
+func (s Span) Counted() bool {
+	return !s.IsMarker() && (s.HadActivity || s.Audible) && s.End.After(s.Start)
+}
+
+// ApplySessionEvents takes spans in order and returns them as they count: checkpoints collapsed into the
+// last row for each start, and spans clipped by the session events written after them. Markers are kept.
+func ApplySessionEvents(spans []Span) []Span {
+	// Collapse checkpoints: a row with the same name and start as the previous one replaces it
+	rows := []Span{}
+	for _, row := range spans {
+		last := len(rows) - 1
+		if last >= 0 && rows[last].Name == row.Name && rows[last].Start.Equal(row.Start) {
+			rows[last] = row
+		} else {
+			rows = append(rows, row)
+		}
+	}
+	clipSessions(rows)
+	return rows
+}
+
+// clipSessions applies session events to rows in place. Rows keep their positions.
+func clipSessions(rows []Span) {
+	// Spans are written before the marker that closed them, so a stop marker clips every earlier span,
+	// and a pause marker (sleep, lock or a user pause from the systray) drops time until its resume marker.
+	// Spans before the previous stop marker were already clipped by it.
+	lastStop := 0
+	for i, marker := range rows {
+		if !sessionStopEvents[marker.Name] {
+			continue
+		}
+		for j := lastStop; j < i; j++ {
+			if rows[j].End.After(marker.Start) {
+				rows[j].End = marker.Start
+			}
+		}
+		lastStop = i
+
+		resumeEvent, pauses := sessionPauseEvents[marker.Name]
+		if !pauses {
+			continue
+		}
+		for j := i + 1; j < len(rows); j++ {
+			if sessionEndEvents[rows[j].Name] {
+				break // the collector stopped while paused, and a new session starts unpaused
+			}
+			if rows[j].Name != resumeEvent {
+				continue
+			}
+			resumeAt := rows[j].Start
+			for k := i + 1; k < j; k++ {
+				if rows[k].Start.Before(resumeAt) {
+					rows[k].Start = resumeAt
+				}
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package trackerdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// SpanSchemaVersion is the version of the span file layout written by this package.
+//
+//	1: name, start, end, tabName, tabUrl, hadActivity[, audible[, keys, clicks, scrolls]] with no version line
+//	2: adds the version line before the header
+//	3: start and end are written in UTC, and zone names the time zone they were recorded in
+const SpanSchemaVersion = 3
+
+// spanKind names span files in their version line
+const spanKind = "spans"
+
+// spanColumns is the column layout written for SpanSchemaVersion
+var spanColumns = []string{"name", "start", "end", "tabName", "tabUrl", "hadActivity", "audible", "keys", "clicks", "scrolls", "zone"}
+
+// Span is a row of a YYYYMMDD.spans.csv file: a period with the same focused app, tab and activity state,
+// or a session event marker (a name starting with @, or Off) with Start == End.
+// Open spans are checkpointed with the same Start; the last row for a name and Start wins.
+type Span struct {
+	Name        string
+	Start       time.Time
+	End         time.Time
+	TabName     string
+	TabUrl      string
+	HadActivity bool
+	Audible     bool              // sound was playing, so idle time is passive rather than absent
+	Input       *InputCounts      // nil if the collector wasn't counting input
+	Zone        string            // time zone at recording time, see LoadZone; empty before version 3
+	Extra       map[string]string // columns added by newer versions, by name; lost in tracker.db and aggregated days
+}
+
+// InputCounts is the number of input events over an interval. Only the kind of each event is
+// counted; which key or button it was is never recorded.
+type InputCounts struct {
+	Keys    int `json:"keys"`
+	Clicks  int `json:"clicks"`
+	Scrolls int `json:"scrolls"`
+}
+
+// SpanReader reads spans from a span file of any version
+type SpanReader struct {
+	t *tableReader
+}
+
+// NewSpanReader returns a reader for the span file in r
+func NewSpanReader(r io.Reader) *SpanReader {
+	return &SpanReader{t: newTableReader(r, spanKind, spanColumns)}
+}
+
+// Read returns the next span, skipping rows whose times don't parse. It returns io.EOF at the end of the file.
+func (r *SpanReader) Read() (Span, error) {
+	for {
+		row, err := r.t.next()
+		if err != nil {
+			return Span{}, err
+		}
+		if span, ok := parseSpan(r.t.cols, row); ok {
+			return span, nil
+		}
+	}
+}
+
+// parseSpan reads a span from a row laid out by cols. It reports false if the times don't parse.
+func parseSpan(cols columns, row []string) (Span, bool) {
+	start, err := time.Parse(time.RFC3339, cols.get(row, "start"))
+	if err != nil {
+		return Span{}, false
+	}
+	end, err := time.Parse(time.RFC3339, cols.get(row, "end"))
+	if err != nil {
+		return Span{}, false
+	}
+	// Show times in the zone they were recorded in. Older rows keep the offset they were written with.
+	zone := cols.get(row, "zone")
+	if loc, err := LoadZone(zone); err == nil {
+		start = start.In(loc)
+		end = end.In(loc)
+	}
+	span := Span{
+		Name:        cols.get(row, "name"),
+		Start:       start,
+		End:         end,
+		TabName:     cols.get(row, "tabName"),
+		TabUrl:      cols.get(row, "tabUrl"),
+		HadActivity: cols.get(row, "hadActivity") == "true",
+		Audible:     cols.get(row, "audible") == "true",
+		Zone:        zone,
+		Extra:       cols.extra(row),
+	}
+	// Input counts are empty when the collector wasn't counting input
+	if keys := cols.get(row, "keys"); keys != "" {
+		span.Input = &InputCounts{}
+		span.Input.Keys, _ = strconv.Atoi(keys)
+		span.Input.Clicks, _ = strconv.Atoi(cols.get(row, "clicks"))
+		span.Input.Scrolls, _ = strconv.Atoi(cols.get(row, "scrolls"))
+	}
+	return span, true
+}
+
+// Day returns the YYYYMMDD date the span started on, in the zone it was recorded in.
+// This is the day file it is stored in.
+func (s Span) Day() string {
+	return s.Start.In(s.location()).Format("20060102")
+}
+
+// location returns the zone the span was recorded in, or its start's location if the zone is unknown
+func (s Span) location() *time.Location {
+	if loc, err := LoadZone(s.Zone); err == nil {
+		return loc
+	}
+	return s.Start.Location()
+}
+
+// Version returns the schema version of the section of the file read last
+func (r *SpanReader) Version() int {
+	return r.t.version
+}
+
+// ReadSpanFile reads every span in a span file
+func ReadSpanFile(path string) ([]Span, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readSpans(f)
+}
+
+// readSpans reads every span from a span file's contents
+func readSpans(r io.Reader) ([]Span, error) {
+	spans := []Span{}
+	reader := NewSpanReader(r)
+	for {
+		span, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return spans, nil
+		}
+		if err != nil {
+			return spans, err
+		}
+		spans = append(spans, span)
+	}
+}
+
+// SpanWriter appends spans to a span file
+type SpanWriter struct {
+	f *os.File
+	w *csv.Writer
+}
+
+// OpenSpanFile opens a span file for appending. A new file is started with the version line and header,
+// and a file last written with another layout gets them again before the first new row.
+func OpenSpanFile(path string) (*SpanWriter, error) {
+	current, err := spanFileIsCurrent(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &SpanWriter{f: f, w: csv.NewWriter(f)}
+	if !current {
+		if err := writeHeader(w.w, spanKind, SpanSchemaVersion, spanColumns); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// spanFileIsCurrent reports whether the last section of an existing span file uses the current layout
+func spanFileIsCurrent(path string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	t := newTableReader(f, spanKind, spanColumns)
+	for {
+		if _, err := t.next(); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return false, nil // unreadable tail; start a fresh section
+			}
+			break
+		}
+	}
+	return t.version == SpanSchemaVersion && slices.Equal(t.cols.names, spanColumns), nil
+}
+
+// Write buffers a span. Extra columns are not written, since the header is already fixed; the collector's
+// own spans have none.
+func (w *SpanWriter) Write(span Span) error {
+	return w.w.Write(spanRow(span, nil))
+}
+
+// extraColumns returns the names of the extra columns of any of spans, sorted
+func extraColumns(spans []Span) []string {
+	names := []string{}
+	for _, span := range spans {
+		for name := range span.Extra {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// spanRow returns the cells of a span in the spanColumns layout, followed by its cells of the extra columns
+func spanRow(span Span, extra []string) []string {
+	keys, clicks, scrolls := "", "", ""
+	if span.Input != nil {
+		keys = strconv.Itoa(span.Input.Keys)
+		clicks = strconv.Itoa(span.Input.Clicks)
+		scrolls = strconv.Itoa(span.Input.Scrolls)
+	}
+	row := []string{
+		span.Name,
+		span.Start.UTC().Format(time.RFC3339),
+		span.End.UTC().Format(time.RFC3339),
+		span.TabName,
+		span.TabUrl,
+		strconv.FormatBool(span.HadActivity),
+		strconv.FormatBool(span.Audible),
+		keys, clicks, scrolls,
+		span.Zone,
+	}
+	for _, name := range extra {
+		row = append(row, span.Extra[name])
+	}
+	return row
+}
+
+// Flush writes buffered spans to the file
+func (w *SpanWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// Sync flushes buffered spans and commits the file to disk
+func (w *SpanWriter) Sync() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// Close flushes buffered spans and closes the file
+func (w *SpanWriter) Close() error {
+	err := w.Flush()
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,379 @@
+package trackerdata
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	// Pure-Go SQLite driver, so neither binary needs cgo for it
+	_ "modernc.org/sqlite"
+)
+
+// DBName is the SQLite database in the data folder
+const DBName = "tracker.db"
+
+// dbSchemaVersion is stored in the meta table so later versions can migrate the database
+const dbSchemaVersion = 1
+
+// dbSchema creates the tables. Times are Unix seconds (UTC) with the recording zone alongside.
+// Checkpoints of an open span share its name and start, so they replace each other.
+const dbSchema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS spans (
+	id           INTEGER PRIMARY KEY,
+	name         TEXT NOT NULL,
+	start        INTEGER NOT NULL,
+	end          INTEGER NOT NULL,
+	zone         TEXT NOT NULL DEFAULT '',
+	tab_name     TEXT NOT NULL DEFAULT '',
+	tab_url      TEXT NOT NULL DEFAULT '',
+	domain       TEXT NOT NULL DEFAULT '',
+	had_activity INTEGER NOT NULL DEFAULT 0,
+	audible      INTEGER NOT NULL DEFAULT 0,
+	keys         INTEGER,
+	clicks       INTEGER,
+	scrolls      INTEGER,
+	UNIQUE (name, start)
+);
+CREATE INDEX IF NOT EXISTS spans_start ON spans (start);
+CREATE INDEX IF NOT EXISTS spans_name ON spans (name, start);
+CREATE INDEX IF NOT EXISTS spans_domain ON spans (domain, start);
+CREATE TABLE IF NOT EXISTS samples (
+	id           INTEGER PRIMARY KEY,
+	name         TEXT NOT NULL,
+	ts           INTEGER NOT NULL,
+	zone         TEXT NOT NULL DEFAULT '',
+	tab_name     TEXT NOT NULL DEFAULT '',
+	tab_url      TEXT NOT NULL DEFAULT '',
+	domain       TEXT NOT NULL DEFAULT '',
+	had_activity INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS samples_ts ON samples (ts);
+CREATE INDEX IF NOT EXISTS samples_name ON samples (name, ts);
+CREATE INDEX IF NOT EXISTS samples_domain ON samples (domain, ts);
+CREATE TABLE IF NOT EXISTS imported_files (
+	name        TEXT PRIMARY KEY,
+	rows        INTEGER NOT NULL,
+	imported_at INTEGER NOT NULL
+);
+`
+
+// DB stores spans, and samples imported from legacy files, in SQLite
+type DB struct {
+	db *sql.DB
+}
+
+// OpenDB opens or creates a database. The collector writes to it while the dashboard reads,
+// so it uses WAL and waits for locks instead of failing.
+func OpenDB(path string) (*DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(dbSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create schema in %s: %w", path, err)
+	}
+	if _, err := db.Exec(`INSERT OR IGNORE INTO meta (key, value) VALUES ('schema_version', ?)`, dbSchemaVersion); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+// Close closes the database
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// AppendSpans writes spans in one transaction. A span with the same name and start as a stored one replaces it.
+func (d *DB) AppendSpans(spans []Span) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertSpans(tx, spans); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertSpans(tx *sql.Tx, spans []Span) error {
+	stmt, err := tx.Prepare(`
+		INSERT INTO spans (name, start, end, zone, tab_name, tab_url, domain, had_activity, audible, keys, clicks, scrolls)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name, start) DO UPDATE SET
+			end = excluded.end, zone = excluded.zone, tab_name = excluded.tab_name, tab_url = excluded.tab_url,
+			domain = excluded.domain, had_activity = excluded.had_activity, audible = excluded.audible,
+			keys = excluded.keys, clicks = excluded.clicks, scrolls = excluded.scrolls`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, span := range spans {
+		var keys, clicks, scrolls sql.NullInt64
+		if span.Input != nil {
+			keys = sql.NullInt64{Int64: int64(span.Input.Keys), Valid: true}
+			clicks = sql.NullInt64{Int64: int64(span.Input.Clicks), Valid: true}
+			scrolls = sql.NullInt64{Int64: int64(span.Input.Scrolls), Valid: true}
+		}
+		_, err := stmt.Exec(span.Name, span.Start.Unix(), span.End.Unix(), recordedZone(span.Zone, span.Start),
+			span.TabName, span.TabUrl, Domain(span.TabUrl), span.HadActivity, span.Audible, keys, clicks, scrolls)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Spans returns the spans that overlap [from, to), in the order they started, with times in their recording zone.
+// A zero to means no upper bound.
+func (d *DB) Spans(from, to time.Time) ([]Span, error) {
+	upper := int64(1<<63 - 1)
+	if !to.IsZero() {
+		upper = to.Unix()
+	}
+	rows, err := d.db.Query(`
+		SELECT name, start, end, zone, tab_name, tab_url, had_activity, audible, keys, clicks, scrolls
+		FROM spans WHERE start < ? AND end >= ? ORDER BY start, id`, upper, from.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spans := []Span{}
+	for rows.Next() {
+		var span Span
+		var start, end int64
+		var keys, clicks, scrolls sql.NullInt64
+		if err := rows.Scan(&span.Name, &start, &end, &span.Zone, &span.TabName, &span.TabUrl,
+			&span.HadActivity, &span.Audible, &keys, &clicks, &scrolls); err != nil {
+			return nil, err
+		}
+		span.Start, span.End = inZone(start, span.Zone), inZone(end, span.Zone)
+		if keys.Valid {
+			span.Input = &InputCounts{Keys: int(keys.Int64), Clicks: int(clicks.Int64), Scrolls: int(scrolls.Int64)}
+		}
+		spans = append(spans, span)
+	}
+	return spans, rows.Err()
+}
+
+// Samples returns the legacy samples taken in [from, to), in order, with times in their recording zone.
+// A zero to means no upper bound.
+func (d *DB) Samples(from, to time.Time) ([]Sample, error) {
+	upper := int64(1<<63 - 1)
+	if !to.IsZero() {
+		upper = to.Unix()
+	}
+	rows, err := d.db.Query(`
+		SELECT name, ts, zone, tab_name, tab_url, had_activity
+		FROM samples WHERE ts >= ? AND ts < ? ORDER BY ts, id`, from.Unix(), upper)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []Sample{}
+	for rows.Next() {
+		var sample Sample
+		var ts int64
+		var zone string
+		if err := rows.Scan(&sample.Name, &ts, &zone, &sample.TabName, &sample.TabUrl, &sample.HadActivity); err != nil {
+			return nil, err
+		}
+		sample.Timestamp = inZone(ts, zone)
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+// ReplaceDay deletes the spans and samples recorded on a YYYYMMDD date, in each row's recording zone,
+// and writes spans in their place, in one transaction
+func (d *DB) ReplaceDay(day string, spans []Span) error {
+	date, err := time.Parse("20060102", day)
+	if err != nil {
+		return err
+	}
+	// Zones are within 14 hours of UTC, so the day's rows start no more than a day either side of its UTC date
+	from, to := date.AddDate(0, 0, -1).Unix(), date.AddDate(0, 0, 2).Unix()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []struct{ name, time string }{{"spans", "start"}, {"samples", "ts"}} {
+		rows, err := tx.Query(`SELECT id, `+table.time+`, zone FROM `+table.name+` WHERE `+table.time+` >= ? AND `+table.time+` < ?`, from, to)
+		if err != nil {
+			return err
+		}
+		ids := []int64{}
+		for rows.Next() {
+			var id, unix int64
+			var zone string
+			if err := rows.Scan(&id, &unix, &zone); err != nil {
+				rows.Close()
+				return err
+			}
+			if inZone(unix, zone).Format("20060102") == day {
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if _, err := tx.Exec(`DELETE FROM `+table.name+` WHERE id = ?`, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := insertSpans(tx, spans); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Days returns the YYYYMMDD dates, in each row's recording zone, that have spans or samples, oldest first
+func (d *DB) Days() ([]string, error) {
+	rows, err := d.db.Query(`SELECT DISTINCT start, zone FROM spans UNION SELECT DISTINCT ts, zone FROM samples`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []string{}
+	for rows.Next() {
+		var unix int64
+		var zone string
+		if err := rows.Scan(&unix, &zone); err != nil {
+			return nil, err
+		}
+		days = append(days, inZone(unix, zone).Format("20060102"))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return mergeDays(days), nil
+}
+
+// ImportedFiles returns the names of the day files that have been imported
+func (d *DB) ImportedFiles() (map[string]bool, error) {
+	rows, err := d.db.Query(`SELECT name FROM imported_files`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		files[name] = true
+	}
+	return files, rows.Err()
+}
+
+// importFile copies a span or legacy sample file into the database in one transaction and records it as imported
+func (d *DB) importFile(path string, name string) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var imported bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM imported_files WHERE name = ?)`, name).Scan(&imported); err != nil {
+		return 0, err
+	}
+	if imported {
+		return 0, fmt.Errorf("%s was already imported", name)
+	}
+
+	var count int
+	if file, _ := parseDayFile(name); file.Spans {
+		spans, err := readSpanDayFile(path)
+		if err != nil {
+			return 0, err
+		}
+		if err := insertSpans(tx, spans); err != nil {
+			return 0, err
+		}
+		count = len(spans)
+	} else {
+		samples, err := ReadSampleFile(path)
+		if err != nil {
+			return 0, err
+		}
+		if err := insertSamples(tx, samples); err != nil {
+			return 0, err
+		}
+		count = len(samples)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO imported_files (name, rows, imported_at) VALUES (?, ?, ?)`, name, count, time.Now().Unix()); err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+func insertSamples(tx *sql.Tx, samples []Sample) error {
+	stmt, err := tx.Prepare(`INSERT INTO samples (name, ts, zone, tab_name, tab_url, domain, had_activity) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, sample := range samples {
+		_, err := stmt.Exec(sample.Name, sample.Timestamp.Unix(), recordedZone("", sample.Timestamp),
+			sample.TabName, sample.TabUrl, Domain(sample.TabUrl), sample.HadActivity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordedZone returns the zone to store with a time: its named zone, or for rows from before zones were
+// recorded, the offset it was written with
+func recordedZone(zone string, t time.Time) string {
+	if zone != "" {
+		return zone
+	}
+	return OffsetZone(t)
+}
+
+// inZone converts Unix seconds to a time in the given zone, falling back to UTC
+func inZone(unix int64, zone string) time.Time {
+	t := time.Unix(unix, 0)
+	if loc, err := LoadZone(zone); err == nil {
+		return t.In(loc)
+	}
+	return t.UTC()
+}
+
+// Domain returns the host of a URL, or "" if there is none. Bare domains are accepted.
+func Domain(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		return strings.TrimPrefix(parsed.Hostname(), "www.")
+	}
+	host, _, _ := strings.Cut(rawURL, "/")
+	return strings.TrimPrefix(host, "www.")
+}
@@ -0,0 +1,530 @@
+package trackerdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Storage backends, chosen per machine by storage.backend in collector.json
+const (
+	BackendCSV    = "csv"    // a YYYYMMDD.spans.csv file per day
+	BackendJSONL  = "jsonl"  // a YYYYMMDD.spans.jsonl file per day
+	BackendSQLite = "sqlite" // tracker.db in the data folder
+)
+
+// SpanLookback is how long before a range file stores look for spans that run into it. A span is stored on
+// the day it started, so one that lasted longer than this is missed by ranges that start after this long.
+const SpanLookback = 7 * 24 * time.Hour
+
+// Store is where the collector appends spans and the dashboard reads them back.
+// Every store reads what older versions left in the data folder, so switching backends hides nothing:
+// day files of every format, and legacy sample files. A store is used from one goroutine at a time.
+type Store interface {
+	// Append writes spans. A span with the same name and start as a stored one is a checkpoint that replaces it.
+	Append(spans []Span) error
+
+	// Spans calls fn for each span that overlaps [from, to), in the order they started, with only the
+	// latest checkpoint of each, up to SpanLookback before from. A zero to means no upper bound. Iteration stops at the first error from fn;
+	// a file that can't be read is skipped, and its error returned once the rest have been read.
+	Spans(from, to time.Time, fn func(Span) error) error
+
+	// Samples calls fn for each legacy sample taken in [from, to), in order. A zero to means no upper bound.
+	Samples(from, to time.Time, fn func(Sample) error) error
+
+	// Days returns the YYYYMMDD dates that have spans or samples, oldest first
+	Days() ([]string, error)
+
+	// ReplaceDay replaces everything stored for a YYYYMMDD date, spans and legacy samples alike, with spans.
+	// Raw copies of the day in the archive folder are deleted.
+	ReplaceDay(day string, spans []Span) error
+
+	// Sync commits appended spans to disk
+	Sync() error
+
+	// Close syncs and releases the store
+	Close() error
+}
+
+// OpenStore opens the store for a backend in dir. An empty backend means the default, csv.
+func OpenStore(backend string, dir string) (Store, error) {
+	switch backend {
+	case "", BackendCSV:
+		return newFileStore(dir, ".spans.csv"), nil
+	case BackendJSONL:
+		return newFileStore(dir, ".spans.jsonl"), nil
+	case BackendSQLite:
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		db, err := OpenDB(filepath.Join(dir, DBName))
+		if err != nil {
+			return nil, err
+		}
+		return &sqliteStore{db: db, files: newFileStore(dir, "")}, nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
+
+// OpenConfiguredStore opens the store for the backend set in collector.json. tracker.db holds imported days
+// even on a machine that writes day files, so the sqlite store, which reads both, is used whenever there is one.
+func OpenConfiguredStore(dir string) (Store, error) {
+	backend := ConfiguredBackend()
+	if _, err := os.Stat(filepath.Join(dir, DBName)); err == nil {
+		backend = BackendSQLite
+	}
+	return OpenStore(backend, dir)
+}
+
+// ConfiguredBackend returns the backend set in collector.json in the data folder, or csv if there is none
+func ConfiguredBackend() string {
+	var config struct {
+		Storage struct {
+			Backend string `json:"backend"`
+		} `json:"storage"`
+	}
+	if data, err := os.ReadFile(Path("collector.json")); err == nil {
+		json.Unmarshal(data, &config)
+	}
+	if config.Storage.Backend == "" {
+		return BackendCSV
+	}
+	return config.Storage.Backend
+}
+
+// spanAppender writes spans to an open day file
+type spanAppender interface {
+	Write(span Span) error
+	Flush() error
+	Sync() error
+	Close() error
+}
+
+// fileStore keeps a day file per date. It writes span files with one extension and reads all of them.
+type fileStore struct {
+	dir  string
+	ext  string // ".spans.csv" or ".spans.jsonl"; empty for a store that is only read
+	file spanAppender
+	day  string // YYYYMMDD of the open file
+}
+
+func newFileStore(dir string, ext string) *fileStore {
+	return &fileStore{dir: dir, ext: ext}
+}
+
+// Append writes each span to the file of the day it started on. The file of the latest day stays open;
+// it is switched once spans for the next day arrive.
+func (s *fileStore) Append(spans []Span) error {
+	if s.ext == "" {
+		return fmt.Errorf("day files in %s are read-only", s.dir)
+	}
+	for len(spans) > 0 {
+		day := spans[0].Day()
+		n := 1
+		for n < len(spans) && spans[n].Day() == day {
+			n++
+		}
+
+		if err := s.open(day); err != nil {
+			return err
+		}
+		for _, span := range spans[:n] {
+			if err := s.file.Write(span); err != nil {
+				return err
+			}
+		}
+		if err := s.file.Flush(); err != nil {
+			return err
+		}
+		spans = spans[n:]
+	}
+	return nil
+}
+
+// open makes the file for the given day the open one
+func (s *fileStore) open(day string) error {
+	if s.file != nil && s.day == day {
+		return nil
+	}
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, day+s.ext)
+	var file spanAppender
+	var err error
+	if s.ext == ".spans.jsonl" {
+		file, err = OpenJSONLSpanFile(path)
+	} else {
+		file, err = OpenSpanFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.day = day
+	return nil
+}
+
+// Sync commits the open file to disk
+func (s *fileStore) Sync() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+// Close fsyncs and closes the open file, if any. A failed close still lets the file go,
+// so the next Append starts again from a fresh open.
+func (s *fileStore) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	file := s.file
+	s.file = nil
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReplaceDay writes the day's compacted file, then deletes the day's other files and archived copies
+func (s *fileStore) ReplaceDay(day string, spans []Span) error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	if err := writeCompacted(s.dir, day, spans); err != nil {
+		return err
+	}
+	return removeDayFiles(s.dir, day, day+CompactedSuffix)
+}
+
+func (s *fileStore) Spans(from, to time.Time, fn func(Span) error) error {
+	return s.spans(from, to, nil, fn)
+}
+
+// spans reads the span files of each day in turn, leaving out files named in skip
+func (s *fileStore) spans(from, to time.Time, skip map[string]bool, fn func(Span) error) error {
+	start := from
+	if !from.IsZero() {
+		start = from.Add(-SpanLookback)
+	}
+	var readErr error
+	err := s.eachDay(start, to, skip, func(day string, files []DayFile) error {
+		// A day may have files in both formats if the backend was switched that day
+		spans := []Span{}
+		for _, file := range files {
+			if !file.Spans {
+				continue
+			}
+			fileSpans, err := readSpanDayFile(filepath.Join(s.dir, file.Name))
+			if err != nil && readErr == nil {
+				readErr = fmt.Errorf("%s: %w", file.Name, err)
+			}
+			spans = append(spans, fileSpans...)
+		}
+		sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+
+		for _, span := range latestCheckpoints(spans) {
+			if !overlaps(span, from, to) {
+				continue
+			}
+			if err := fn(span); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return readErr
+}
+
+func (s *fileStore) Samples(from, to time.Time, fn func(Sample) error) error {
+	return s.samples(from, to, nil, fn)
+}
+
+// samples reads the legacy sample files of each day in turn, leaving out files named in skip
+func (s *fileStore) samples(from, to time.Time, skip map[string]bool, fn func(Sample) error) error {
+	var readErr error
+	err := s.eachDay(from, to, skip, func(day string, files []DayFile) error {
+		for _, file := range files {
+			if file.Spans {
+				continue
+			}
+			samples, err := ReadSampleFile(filepath.Join(s.dir, file.Name))
+			if err != nil && readErr == nil {
+				readErr = fmt.Errorf("%s: %w", file.Name, err)
+			}
+			for _, sample := range samples {
+				if sample.Timestamp.Before(from) || (!to.IsZero() && !sample.Timestamp.Before(to)) {
+					continue
+				}
+				if err := fn(sample); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return readErr
+}
+
+// eachDay calls fn with the day files of each date in turn, from the date of from up to the date of to.
+// A zero from or to leaves that end open. A missing folder has no days.
+func (s *fileStore) eachDay(from, to time.Time, skip map[string]bool, fn func(day string, files []DayFile) error) error {
+	files, err := ListDayFiles(s.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Files are named by the date in their recording zone, which may be a day either side of UTC
+	first, last := "", ""
+	if !from.IsZero() {
+		first = from.UTC().AddDate(0, 0, -1).Format("20060102")
+	}
+	if !to.IsZero() {
+		last = to.UTC().AddDate(0, 0, 1).Format("20060102")
+	}
+	for len(files) > 0 {
+		day := files[0].Day
+		n := 1
+		for n < len(files) && files[n].Day == day {
+			n++
+		}
+		if last != "" && day > last {
+			return nil
+		}
+		if day < first {
+			files = files[n:]
+			continue
+		}
+
+		group := []DayFile{}
+		for _, file := range files[:n] {
+			if !skip[file.Name] {
+				group = append(group, file)
+			}
+		}
+		if len(group) > 0 {
+			if err := fn(day, group); err != nil {
+				return err
+			}
+		}
+		files = files[n:]
+	}
+	return nil
+}
+
+func (s *fileStore) Days() ([]string, error) {
+	return s.days(nil)
+}
+
+// days lists the dates that have day files, leaving out files named in skip
+func (s *fileStore) days(skip map[string]bool) ([]string, error) {
+	days := []string{}
+	err := s.eachDay(time.Time{}, time.Time{}, skip, func(day string, files []DayFile) error {
+		days = append(days, day)
+		return nil
+	})
+	return days, err
+}
+
+// sqliteStore writes to tracker.db, and reads it together with the day files that haven't been imported into it
+type sqliteStore struct {
+	db    *DB
+	files *fileStore
+}
+
+func (s *sqliteStore) Append(spans []Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	return s.db.AppendSpans(spans)
+}
+
+// Sync does nothing, since every Append is committed
+func (s *sqliteStore) Sync() error {
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// ReplaceDay replaces the day in the database, then deletes the day's files that haven't been imported
+// and archived copies
+func (s *sqliteStore) ReplaceDay(day string, spans []Span) error {
+	if err := s.db.ReplaceDay(day, spans); err != nil {
+		return err
+	}
+	return removeDayFiles(s.files.dir, day, "")
+}
+
+func (s *sqliteStore) Spans(from, to time.Time, fn func(Span) error) error {
+	spans, err := s.db.Spans(from, to)
+	if err != nil {
+		return err
+	}
+	imported, err := s.db.ImportedFiles()
+	if err != nil {
+		return err
+	}
+	// An unreadable day file is reported after everything else has been read
+	filesErr := s.files.spans(from, to, imported, func(span Span) error {
+		spans = append(spans, span)
+		return nil
+	})
+
+	// The database and the day files may cover the same period, so merge them by time.
+	// The sort is stable so spans with the same start keep the order they were written in.
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	for _, span := range spans {
+		if err := fn(span); err != nil {
+			return err
+		}
+	}
+	return filesErr
+}
+
+func (s *sqliteStore) Samples(from, to time.Time, fn func(Sample) error) error {
+	samples, err := s.db.Samples(from, to)
+	if err != nil {
+		return err
+	}
+	imported, err := s.db.ImportedFiles()
+	if err != nil {
+		return err
+	}
+	filesErr := s.files.samples(from, to, imported, func(sample Sample) error {
+		samples = append(samples, sample)
+		return nil
+	})
+
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Timestamp.Before(samples[j].Timestamp) })
+	for _, sample := range samples {
+		if err := fn(sample); err != nil {
+			return err
+		}
+	}
+	return filesErr
+}
+
+func (s *sqliteStore) Days() ([]string, error) {
+	days, err := s.db.Days()
+	if err != nil {
+		return nil, err
+	}
+	imported, err := s.db.ImportedFiles()
+	if err != nil {
+		return nil, err
+	}
+	fileDays, err := s.files.days(imported)
+	if err != nil {
+		return nil, err
+	}
+	return mergeDays(days, fileDays), nil
+}
+
+// removeDayFiles deletes the files of a day in dir, except keep, and its copies in the archive folder
+func removeDayFiles(dir string, day string, keep string) error {
+	files, err := ListDayFiles(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	archived, err := listArchivedFiles(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	paths := []string{}
+	for _, file := range files {
+		if file.Day == day && file.Name != keep {
+			paths = append(paths, filepath.Join(dir, file.Name))
+		}
+	}
+	for _, file := range archived {
+		if file.Day == day {
+			paths = append(paths, filepath.Join(dir, ArchiveDir, file.Name))
+		}
+	}
+	for _, path := range paths {
+		os.Chmod(path, 0644) // archived copies are read-only, which stops deletion on Windows
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archivedDays returns the days that have raw copies in the archive folder
+func archivedDays(dir string) (map[string]bool, error) {
+	days := map[string]bool{}
+	files, err := listArchivedFiles(dir)
+	if os.IsNotExist(err) {
+		return days, nil
+	}
+	for _, file := range files {
+		days[file.Day] = true
+	}
+	return days, err
+}
+
+// latestCheckpoints keeps the last row written for each name and start, at the position of the first
+func latestCheckpoints(spans []Span) []Span {
+	type key struct {
+		name  string
+		start int64
+	}
+	index := map[key]int{}
+	rows := []Span{}
+	for _, span := range spans {
+		k := key{span.Name, span.Start.Unix()}
+		if i, ok := index[k]; ok {
+			rows[i] = span
+			continue
+		}
+		index[k] = len(rows)
+		rows = append(rows, span)
+	}
+	return rows
+}
+
+// overlaps reports whether a span overlaps [from, to); a zero to means no upper bound.
+// Markers, which start and end at once, overlap the range they fall in.
+func overlaps(span Span, from, to time.Time) bool {
+	return !span.End.Before(from) && (to.IsZero() || span.Start.Before(to))
+}
+
+// mergeDays returns the sorted union of date lists
+func mergeDays(lists ...[]string) []string {
+	seen := map[string]bool{}
+	days := []string{}
+	for _, list := range lists {
+		for _, day := range list {
+			if !seen[day] {
+				seen[day] = true
+				days = append(days, day)
+			}
+		}
+	}
+	sort.Strings(days)
+	return days
+}
@@ -0,0 +1,249 @@
+package trackerdata
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// storeBackends opens each kind of store on an empty folder
+var storeBackends = []struct {
+	name string
+	open func(dir string) (Store, error)
+}{
+	{BackendCSV, func(dir string) (Store, error) { return OpenStore(BackendCSV, dir) }},
+	{BackendJSONL, func(dir string) (Store, error) { return OpenStore(BackendJSONL, dir) }},
+	{BackendSQLite, func(dir string) (Store, error) { return OpenStore(BackendSQLite, dir) }},
+	{"memory", func(string) (Store, error) { return NewMemoryStore(), nil }},
+}
+
+// eachStore runs a test against every kind of store
+func eachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	for _, backend := range storeBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store, err := backend.open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			test(t, store)
+		})
+	}
+}
+
+// at returns a time on March 1st 2024 (UTC), hours from midnight
+func at(hours float64) time.Time {
+	return time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(hours * float64(time.Hour)))
+}
+
+// testSpan returns an active span between two times given as hours after midnight on March 1st
+func testSpan(name string, from, to float64) Span {
+	return Span{Name: name, Start: at(from), End: at(to), TabUrl: "https://example.com/" + name, HadActivity: true, Zone: "UTC"}
+}
+
+// readStore returns every span a store returns for [from, to)
+func readStore(t *testing.T, store Store, from, to time.Time) []Span {
+	t.Helper()
+	spans := []Span{}
+	if err := store.Spans(from, to, func(span Span) error {
+		spans = append(spans, span)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
+
+// checkSpans compares spans by name, times, URL, activity and zone
+func checkSpans(t *testing.T, got, want []Span) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d spans %v, want %d %v", len(got), got, len(want), want)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Name != w.Name || !g.Start.Equal(w.Start) || !g.End.Equal(w.End) || g.TabUrl != w.TabUrl ||
+			g.HadActivity != w.HadActivity || g.Zone != w.Zone {
+			t.Errorf("span %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestStoreAppend(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		spans := []Span{
+			testSpan("editor", 9, 10),
+			{Name: "@locked", Start: at(10), End: at(10), Zone: "UTC"},
+			testSpan("browser", 33, 34), // the next day
+		}
+		if err := store.Append(spans[:2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Append(spans[2:]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		checkSpans(t, readStore(t, store, time.Time{}, time.Time{}), spans)
+	})
+}
+
+func TestStoreCheckpoint(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		// An open span is checkpointed with the same start, in later batches and after other spans
+		for _, batch := range [][]Span{
+			{testSpan("editor", 9, 9.5)},
+			{testSpan("browser", 8, 9), testSpan("editor", 9, 10)},
+			{testSpan("editor", 9, 11)},
+		} {
+			if err := store.Append(batch); err != nil {
+				t.Fatal(err)
+			}
+		}
+		checkSpans(t, readStore(t, store, time.Time{}, time.Time{}), []Span{testSpan("browser", 8, 9), testSpan("editor", 9, 11)})
+	})
+}
+
+func TestStoreSpansRange(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		if err := store.Append([]Span{
+			testSpan("before", 7, 8),
+			testSpan("overlapping", 8.5, 10),
+			testSpan("inside", 10, 11),
+			testSpan("at-end", 12, 13),
+			testSpan("overnight", 20, 34), // stored on March 1st, runs into the next day
+			testSpan("next-day", 33, 34),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name     string
+			from, to time.Time
+			want     []string
+		}{
+			{"bounded", at(9), at(12), []string{"overlapping", "inside"}},
+			{"no upper bound", at(11.5), time.Time{}, []string{"at-end", "overnight", "next-day"}},
+			{"next day only", at(24), at(48), []string{"overnight", "next-day"}},
+			{"empty", at(14), at(20), []string{}},
+		}
+		for _, test := range tests {
+			names := []string{}
+			for _, span := range readStore(t, store, test.from, test.to) {
+				names = append(names, span.Name)
+			}
+			if !slices.Equal(names, test.want) {
+				t.Errorf("%s: got %v, want %v", test.name, names, test.want)
+			}
+		}
+	})
+}
+
+func TestFileStoreReadsOnlyTheLookback(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(BackendCSV, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Append([]Span{testSpan("editor", 9, 10)}); err != nil {
+		t.Fatal(err)
+	}
+	// A day file long before the range that can't be read
+	if err := os.WriteFile(filepath.Join(dir, "20240101"+CompactedSuffix), []byte("not gzip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkSpans(t, readStore(t, store, at(0), at(24)), []Span{testSpan("editor", 9, 10)})
+	if err := store.Spans(time.Time{}, at(24), func(Span) error { return nil }); err == nil {
+		t.Error("reading from the start didn't read the old file")
+	}
+}
+
+func TestStoreDays(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		days, err := store.Days()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(days) != 0 {
+			t.Errorf("empty store has days %v", days)
+		}
+
+		// A span is stored on the day it started in its recording zone, which may differ from its UTC date
+		late := testSpan("late", 23, 23.5)
+		late.Zone = "Asia/Tokyo"
+		if err := store.Append([]Span{testSpan("a", 9, 10), testSpan("b", 57, 58), late}); err != nil {
+			t.Fatal(err)
+		}
+		days, err = store.Days()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"20240301", "20240302", "20240303"}; !slices.Equal(days, want) {
+			t.Errorf("got days %v, want %v", days, want)
+		}
+	})
+}
+
+func TestStoreReplaceDay(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		if err := store.Append([]Span{testSpan("a", 9, 10), testSpan("b", 11, 12), testSpan("c", 33, 34)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ReplaceDay("20240301", []Span{testSpan("total", 0, 2)}); err != nil {
+			t.Fatal(err)
+		}
+		checkSpans(t, readStore(t, store, time.Time{}, time.Time{}), []Span{testSpan("total", 0, 2), testSpan("c", 33, 34)})
+	})
+}
+
+func TestStoresReadEachOthersFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	// Each file backend writes a day; the sqlite store writes a third to tracker.db
+	written := []Span{testSpan("csv", 9, 10), testSpan("jsonl", 33, 34), testSpan("sqlite", 57, 58)}
+	for i, backend := range []string{BackendCSV, BackendJSONL, BackendSQLite} {
+		store, err := OpenStore(backend, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Append(written[i : i+1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Day files are read whatever the backend; only the sqlite store reads tracker.db
+	tests := []struct {
+		backend string
+		want    []Span
+	}{
+		{BackendCSV, written[:2]},
+		{BackendJSONL, written[:2]},
+		{BackendSQLite, written},
+	}
+	for _, test := range tests {
+		t.Run(test.backend, func(t *testing.T) {
+			store, err := OpenStore(test.backend, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			checkSpans(t, readStore(t, store, time.Time{}, time.Time{}), test.want)
+
+			days, err := store.Days()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(days) != len(test.want) {
+				t.Errorf("got days %v, want %d", days, len(test.want))
+			}
+		})
+	}
+}
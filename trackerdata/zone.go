@@ -0,0 +1,58 @@
+package trackerdata
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	// Windows has no zone database of its own, so embed one for loading IANA names
+	_ "time/tzdata"
+)
+
+var (
+	zones   = map[string]*time.Location{}
+	zonesMu sync.Mutex
+)
+
+// LoadZone returns the location for a zone column value: an IANA name such as "Europe/Berlin",
+// or a fixed offset such as "+02:00" when the recording machine couldn't name its zone.
+// Locations are cached, since spans repeat the same few zones.
+func LoadZone(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, errors.New("no time zone")
+	}
+
+	zonesMu.Lock()
+	defer zonesMu.Unlock()
+	if loc, ok := zones[name]; ok {
+		return loc, nil
+	}
+
+	loc, err := loadZone(name)
+	if err != nil {
+		return nil, err
+	}
+	zones[name] = loc
+	return loc, nil
+}
+
+func loadZone(name string) (*time.Location, error) {
+	if name[0] == '+' || name[0] == '-' {
+		var hours, minutes int
+		if _, err := fmt.Sscanf(name[1:], "%d:%d", &hours, &minutes); err != nil {
+			return nil, fmt.Errorf("bad time zone offset %q", name)
+		}
+		offset := hours*3600 + minutes*60
+		if name[0] == '-' {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	}
+	return time.LoadLocation(name)
+}
+
+// OffsetZone returns the fixed-offset zone name for t, used when the zone has no IANA name
+func OffsetZone(t time.Time) string {
+	return t.Format("-07:00")
+}